@@ -15,49 +15,111 @@
 package exec
 
 import (
-	"fmt"
 	"os"
 
 	"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis"
 	"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/controller"
+	"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/controller/helmrelease"
+	"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/utils"
+	"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/webhook"
 
-	"k8s.io/client-go/rest"
 	"k8s.io/klog"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
 )
 
 // Change below variables to serve metrics on different host or port.
 var (
-	metricsHost             = "0.0.0.0"
-	metricsPort         int = 8382
 	operatorMetricsPort int = 8685
 )
 
 // RunManager starts the actual manager
 func RunManager() {
-	enableLeaderElection := false
-	if _, err := rest.InClusterConfig(); err == nil {
-		klog.Info("LeaderElection enabled as running in a cluster")
-		enableLeaderElection = true
-	} else {
-		klog.Info("LeaderElection disabled as not running in a cluster")
+	if err := processEnv(); err != nil {
+		klog.Error(err, "")
+		os.Exit(1)
 	}
 
-	// Create a new Cmd to provide shared dependencies and start components
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		MetricsBindAddress:      fmt.Sprintf("%s:%d", metricsHost, metricsPort),
+	utils.ChartCacheMaxSize = options.ChartCacheMaxSizeMB << 20
+	utils.ChartCacheMaxAge = options.ChartCacheMaxAge
+	utils.ChartCacheIndexTTL = options.ChartCacheIndexTTL
+	helmrelease.OverrideValues = options.OverrideValues
+
+	for name, backoff := range map[string]helmrelease.Backoff{
+		"download":  options.DownloadBackoff,
+		"release":   options.ReleaseBackoff,
+		"uninstall": options.UninstallBackoff,
+	} {
+		if backoff.BaseDelay <= 0 || backoff.MaxDelay < backoff.BaseDelay {
+			klog.Error("The ", name, " retry delays must be positive and the max delay must not be below the base delay")
+			os.Exit(1)
+		}
+	}
+
+	helmrelease.DownloadBackoff = options.DownloadBackoff
+	helmrelease.ReleaseBackoff = options.ReleaseBackoff
+	helmrelease.UninstallBackoff = options.UninstallBackoff
+	helmrelease.ResyncInterval = options.ResyncInterval
+	helmrelease.ChartsDir = options.ChartsDir
+	helmrelease.WatchNamespaces = options.Namespaces
+
+	if options.MaxConcurrentReconciles < 1 {
+		klog.Error("The max concurrent reconciles must be positive")
+		os.Exit(1)
+	}
+
+	helmrelease.MaxConcurrentReconciles = options.MaxConcurrentReconciles
+
+	klog.Info("LeaderElection enabled: ", options.LeaderElection)
+
+	mgrOptions := ctrl.Options{
+		MetricsBindAddress:      options.MetricsAddr,
+		HealthProbeBindAddress:  options.HealthProbeAddr,
 		Port:                    operatorMetricsPort,
-		LeaderElection:          enableLeaderElection,
-		LeaderElectionID:        "multicloud-operators-subscription-release-leader.open-cluster-management.io",
-		LeaderElectionNamespace: "kube-system",
-	})
+		CertDir:                 options.WebhookCertDir,
+		LeaderElection:          options.LeaderElection,
+		LeaderElectionID:        options.LeaderElectionID,
+		LeaderElectionNamespace: options.LeaderElectionNamespace,
+	}
+
+	if options.SyncPeriod > 0 {
+		mgrOptions.SyncPeriod = &options.SyncPeriod
+	}
+
+	// the namespaced caches restrict the reconciled HelmReleases and the watches of their resources
+	switch len(options.Namespaces) {
+	case 0:
+		klog.Info("Watching all the namespaces")
+	case 1:
+		klog.Info("Watching the namespace ", options.Namespaces[0])
+
+		mgrOptions.Namespace = options.Namespaces[0]
+	default:
+		klog.Info("Watching the namespaces ", options.Namespaces)
+
+		mgrOptions.NewCache = cache.MultiNamespacedCacheBuilder(options.Namespaces)
+	}
+
+	// Create a new Cmd to provide shared dependencies and start components
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), mgrOptions)
 
 	if err != nil {
 		klog.Error(err, "")
 		os.Exit(1)
 	}
 
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		klog.Error(err, "")
+		os.Exit(1)
+	}
+
+	if err := mgr.AddReadyzCheck("ping", healthz.Ping); err != nil {
+		klog.Error(err, "")
+		os.Exit(1)
+	}
+
 	klog.Info("Registering Components.")
 
 	// Setup Scheme for all resources
@@ -72,6 +134,14 @@ func RunManager() {
 		os.Exit(1)
 	}
 
+	// Setup the admission webhooks
+	if options.EnableWebhooks {
+		if err := webhook.AddToManager(mgr); err != nil {
+			klog.Error(err, "")
+			os.Exit(1)
+		}
+	}
+
 	sig := signals.SetupSignalHandler()
 
 	klog.Info("Starting the Cmd.")
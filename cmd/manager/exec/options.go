@@ -15,26 +15,254 @@
 package exec
 
 import (
+	"fmt"
+	"os"
+	"time"
+
 	pflag "github.com/spf13/pflag"
+	"k8s.io/client-go/rest"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+	"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/controller/helmrelease"
+	"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/utils"
 )
 
 // SubscriptionReleaseCMDOptions for command line flag parsing
 type SubscriptionReleaseCMDOptions struct {
-	MetricsAddr string
+	MetricsAddr             string
+	HealthProbeAddr         string
+	MaxConcurrentReconciles int
+	ChartsDir               string
+	ChartCacheMaxSizeMB     int64
+	ChartCacheMaxAge        time.Duration
+	ChartCacheIndexTTL      time.Duration
+	OverrideValues          map[string]string
+	EnableWebhooks          bool
+	WebhookCertDir          string
+	DownloadBackoff         helmrelease.Backoff
+	ReleaseBackoff          helmrelease.Backoff
+	UninstallBackoff        helmrelease.Backoff
+	ResyncInterval          time.Duration
+	LeaderElection          bool
+	LeaderElectionNamespace string
+	LeaderElectionID        string
+	SyncPeriod              time.Duration
+	Namespaces              []string
 }
 
 var options = SubscriptionReleaseCMDOptions{
-	MetricsAddr: "",
+	MetricsAddr:             "0.0.0.0:8382",
+	HealthProbeAddr:         "0.0.0.0:8383",
+	MaxConcurrentReconciles: helmrelease.MaxConcurrentReconciles,
+	ChartsDir:               "",
+	ChartCacheMaxSizeMB:     utils.ChartCacheMaxSize >> 20,
+	ChartCacheMaxAge:        utils.ChartCacheMaxAge,
+	ChartCacheIndexTTL:      utils.ChartCacheIndexTTL,
+	OverrideValues:          map[string]string{},
+	EnableWebhooks:          false,
+	WebhookCertDir:          "",
+	DownloadBackoff:         helmrelease.DownloadBackoff,
+	ReleaseBackoff:          helmrelease.ReleaseBackoff,
+	UninstallBackoff:        helmrelease.UninstallBackoff,
+	ResyncInterval:          helmrelease.ResyncInterval,
+	LeaderElection:          false,
+	LeaderElectionNamespace: "kube-system",
+	LeaderElectionID:        "multicloud-operators-subscription-release-leader.open-cluster-management.io",
+	SyncPeriod:              0,
+	Namespaces:              []string{},
+}
+
+// envVars are the environment variables setting the flags not set on the command line
+var envVars = map[string]string{
+	"metrics-addr":              "METRICS_ADDR",
+	"health-probe-addr":         "HEALTH_PROBE_ADDR",
+	"max-concurrent-reconciles": "MAX_CONCURRENT_RECONCILES",
+	"charts-dir":                appv1.ChartsDir,
+	"leader-elect":              "LEADER_ELECT",
+	"leader-election-namespace": "LEADER_ELECTION_NAMESPACE",
+	"leader-election-id":        "LEADER_ELECTION_ID",
+	"sync-period":               "SYNC_PERIOD",
+	"namespaces":                "WATCH_NAMESPACE",
 }
 
 // ProcessFlags parses command line parameters into options
 func ProcessFlags() {
+	// the leader election is enabled by default when running in a cluster
+	if _, err := rest.InClusterConfig(); err == nil {
+		options.LeaderElection = true
+	}
+
 	flag := pflag.CommandLine
 	// add flags
 	flag.StringVar(
 		&options.MetricsAddr,
 		"metrics-addr",
 		options.MetricsAddr,
-		"The address the metric endpoint binds to.",
+		"The address the metric endpoint binds to, 0 disables the metrics.",
+	)
+
+	flag.StringVar(
+		&options.HealthProbeAddr,
+		"health-probe-addr",
+		options.HealthProbeAddr,
+		"The address the /healthz and /readyz probe endpoints bind to, 0 disables the probes.",
+	)
+
+	flag.IntVar(
+		&options.MaxConcurrentReconciles,
+		"max-concurrent-reconciles",
+		options.MaxConcurrentReconciles,
+		"The number of HelmReleases reconciled concurrently.",
+	)
+
+	flag.StringVar(
+		&options.ChartsDir,
+		"charts-dir",
+		options.ChartsDir,
+		"The directory where the charts are downloaded and expanded (Default a new <tmp>/charts* directory).",
+	)
+
+	flag.Int64Var(
+		&options.ChartCacheMaxSizeMB,
+		"chart-cache-max-size-mb",
+		options.ChartCacheMaxSizeMB,
+		"The size in MiB above which the least recently used charts are evicted from the chart cache.",
+	)
+
+	flag.DurationVar(
+		&options.ChartCacheMaxAge,
+		"chart-cache-max-age",
+		options.ChartCacheMaxAge,
+		"The duration after which the unused charts are evicted from the chart cache.",
+	)
+
+	flag.DurationVar(
+		&options.ChartCacheIndexTTL,
+		"chart-cache-index-ttl",
+		options.ChartCacheIndexTTL,
+		"The duration a helm repo index.yaml is used before it is downloaded again.",
+	)
+
+	flag.StringToStringVar(
+		&options.OverrideValues,
+		"override-values",
+		options.OverrideValues,
+		"The key.path=value overrides, in the helm --set format, applied to the values of every HelmRelease.",
+	)
+
+	flag.BoolVar(
+		&options.EnableWebhooks,
+		"enable-webhooks",
+		options.EnableWebhooks,
+		"Serve the HelmRelease admission webhooks, a serving certificate is required in the webhook cert dir.",
+	)
+
+	flag.StringVar(
+		&options.WebhookCertDir,
+		"webhook-cert-dir",
+		options.WebhookCertDir,
+		"The directory holding the tls.crt and tls.key of the webhook server (Default <tmp>/k8s-webhook-server/serving-certs).",
+	)
+
+	flag.DurationVar(
+		&options.DownloadBackoff.BaseDelay,
+		"download-retry-base-delay",
+		options.DownloadBackoff.BaseDelay,
+		"The delay before retrying a failed chart download, it doubles with each consecutive failure.",
+	)
+
+	flag.DurationVar(
+		&options.DownloadBackoff.MaxDelay,
+		"download-retry-max-delay",
+		options.DownloadBackoff.MaxDelay,
+		"The maximum delay between the retries of a failed chart download.",
+	)
+
+	flag.DurationVar(
+		&options.ReleaseBackoff.BaseDelay,
+		"release-retry-base-delay",
+		options.ReleaseBackoff.BaseDelay,
+		"The delay before retrying a failed install, upgrade or rollback, it doubles with each consecutive failure.",
+	)
+
+	flag.DurationVar(
+		&options.ReleaseBackoff.MaxDelay,
+		"release-retry-max-delay",
+		options.ReleaseBackoff.MaxDelay,
+		"The maximum delay between the retries of a failed install, upgrade or rollback.",
+	)
+
+	flag.DurationVar(
+		&options.UninstallBackoff.BaseDelay,
+		"uninstall-retry-base-delay",
+		options.UninstallBackoff.BaseDelay,
+		"The delay before checking again the deletion of the release resources, it doubles with each check.",
 	)
+
+	flag.DurationVar(
+		&options.UninstallBackoff.MaxDelay,
+		"uninstall-retry-max-delay",
+		options.UninstallBackoff.MaxDelay,
+		"The maximum delay between the checks of the deletion of the release resources.",
+	)
+
+	flag.DurationVar(
+		&options.ResyncInterval,
+		"resync-interval",
+		options.ResyncInterval,
+		"The interval at which the deployed releases are reconciled, 0 disables the periodic resync.",
+	)
+
+	flag.BoolVar(
+		&options.LeaderElection,
+		"leader-elect",
+		options.LeaderElection,
+		"Elect a leader among the operator replicas (Default true when running in a cluster).",
+	)
+
+	flag.StringVar(
+		&options.LeaderElectionNamespace,
+		"leader-election-namespace",
+		options.LeaderElectionNamespace,
+		"The namespace of the leader election lock.",
+	)
+
+	flag.StringVar(
+		&options.LeaderElectionID,
+		"leader-election-id",
+		options.LeaderElectionID,
+		"The name of the leader election lock.",
+	)
+
+	flag.DurationVar(
+		&options.SyncPeriod,
+		"sync-period",
+		options.SyncPeriod,
+		"The period of the resync of the watched resources cache (Default 10h).",
+	)
+
+	flag.StringSliceVar(
+		&options.Namespaces,
+		"namespaces",
+		options.Namespaces,
+		"The comma separated namespaces whose HelmReleases are reconciled (Default all the namespaces).",
+	)
+}
+
+// processEnv sets the flags not set on the command line from their environment variable
+func processEnv() error {
+	flag := pflag.CommandLine
+
+	for name, env := range envVars {
+		value := os.Getenv(env)
+		if value == "" || flag.Changed(name) {
+			continue
+		}
+
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s environment variable: %w", env, err)
+		}
+	}
+
+	return nil
 }
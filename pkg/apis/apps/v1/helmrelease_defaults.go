@@ -0,0 +1,81 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"strings"
+)
+
+//DefaultGitBranch is the branch of the git sources without branch, tag or commit
+const DefaultGitBranch = "master"
+
+// Default sets the defaults of the HelmRelease: an empty spec to install the chart with its default values,
+// the source type inferred from the source block when it is not set, the git branch and the valuesFrom key
+func (hr *HelmRelease) Default() {
+	if hr.Spec == nil {
+		hr.Spec = map[string]interface{}{}
+	}
+
+	if s := hr.Repo.Source; s != nil {
+		s.SourceType = SourceTypeEnum(strings.ToLower(string(s.SourceType)))
+
+		if s.SourceType == "" {
+			s.SourceType = s.inferSourceType()
+		}
+
+		if s.GitHub != nil && s.GitHub.Branch == "" && s.GitHub.Tag == "" && s.GitHub.Commit == "" {
+			s.GitHub.Branch = DefaultGitBranch
+		}
+
+		if s.Git != nil && s.Git.Branch == "" && s.Git.Tag == "" && s.Git.Commit == "" {
+			s.Git.Branch = DefaultGitBranch
+		}
+	}
+
+	for i := range hr.ValuesFrom {
+		if hr.ValuesFrom[i].ValuesKey == "" {
+			hr.ValuesFrom[i].ValuesKey = DefaultValuesKey
+		}
+	}
+}
+
+// inferSourceType returns the type of the only source block set, empty when none or several are set
+func (s *Source) inferSourceType() SourceTypeEnum {
+	types := []SourceTypeEnum{}
+
+	if s.HelmRepo != nil {
+		types = append(types, HelmRepoSourceType)
+	}
+
+	if s.GitHub != nil {
+		types = append(types, GitHubSourceType)
+	}
+
+	if s.Git != nil {
+		types = append(types, GitSourceType)
+	}
+
+	if s.OCI != nil {
+		types = append(types, OCISourceType)
+	}
+
+	if len(types) != 1 {
+		return ""
+	}
+
+	return types[0]
+}
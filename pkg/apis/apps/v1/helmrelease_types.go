@@ -43,6 +43,8 @@ const (
 	GitHubSourceType SourceTypeEnum = "github"
 	// GitSourceType git source type
 	GitSourceType SourceTypeEnum = "git"
+	// OCISourceType oci registry source type
+	OCISourceType SourceTypeEnum = "oci"
 )
 
 //GitHub provides the parameters to access the helm-chart located in a github repo
@@ -50,6 +52,12 @@ type GitHub struct {
 	Urls      []string `json:"urls,omitempty"`
 	ChartPath string   `json:"chartPath,omitempty"`
 	Branch    string   `json:"branch,omitempty"`
+	// Tag to checkout instead of the branch
+	Tag string `json:"tag,omitempty"`
+	// Commit SHA to checkout, it takes precedence over the tag and the branch
+	Commit string `json:"commit,omitempty"`
+	// PollInterval enables the polling of the branch or tag, the release is upgraded when its commit moves
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
 }
 
 //Git provides the parameters to access the helm-chart located in a git repo
@@ -57,6 +65,12 @@ type Git struct {
 	Urls      []string `json:"urls,omitempty"`
 	ChartPath string   `json:"chartPath,omitempty"`
 	Branch    string   `json:"branch,omitempty"`
+	// Tag to checkout instead of the branch
+	Tag string `json:"tag,omitempty"`
+	// Commit SHA to checkout, it takes precedence over the tag and the branch
+	Commit string `json:"commit,omitempty"`
+	// PollInterval enables the polling of the branch or tag, the release is upgraded when its commit moves
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
 }
 
 //HelmRepo provides the urls to retrieve the helm-chart
@@ -64,12 +78,19 @@ type HelmRepo struct {
 	Urls []string `json:"urls,omitempty"`
 }
 
+//OCI provides the urls to retrieve the helm-chart from an OCI registry (e.g. oci://registry/namespace/chart),
+//the chart tag is the Repo.Version
+type OCI struct {
+	Urls []string `json:"urls,omitempty"`
+}
+
 //Source holds the different types of repository
 type Source struct {
 	SourceType SourceTypeEnum `json:"type,omitempty"`
 	GitHub     *GitHub        `json:"github,omitempty"`
 	Git        *Git           `json:"git,omitempty"`
 	HelmRepo   *HelmRepo      `json:"helmRepo,omitempty"`
+	OCI        *OCI           `json:"oci,omitempty"`
 }
 
 func (s Source) String() string {
@@ -80,11 +101,19 @@ func (s Source) String() string {
 		return fmt.Sprintf("%v|%s|%s", s.GitHub.Urls, s.GitHub.Branch, s.GitHub.ChartPath)
 	case string(GitSourceType):
 		return fmt.Sprintf("%v|%s|%s", s.Git.Urls, s.Git.Branch, s.Git.ChartPath)
+	case string(OCISourceType):
+		return fmt.Sprintf("%v", s.OCI.Urls)
 	default:
 		return fmt.Sprintf("SourceType %s not supported", s.SourceType)
 	}
 }
 
+//ChartVerification provides the keyring to verify the chart provenance file
+type ChartVerification struct {
+	// KeyringSecretRef is the secret containing the PGP public keyring under the keyring key
+	KeyringSecretRef *corev1.ObjectReference `json:"keyringSecretRef,omitempty"`
+}
+
 // HelmReleaseRepo defines the repository of HelmRelease
 // +k8s:openapi-gen=true
 type HelmReleaseRepo struct {
@@ -95,30 +124,162 @@ type HelmReleaseRepo struct {
 	Source *Source `json:"source,omitempty"`
 	// ChartName is the name of the chart within the repo
 	ChartName string `json:"chartName,omitempty"`
-	// Version is the chart version
+	// Version is the chart version. For helm repos it can also be a semver range (e.g. ~1.4), in which
+	// case the highest matching version of the repo index is installed and upgraded to periodically
 	Version string `json:"version,omitempty"`
-	// Digest is the helm repo chart digest
+	// Digest is the helm repo chart sha256 digest, the downloaded chart is rejected when it does not match
 	Digest string `json:"digest,omitempty"`
 	// Secret to use to access the helm-repo defined in the CatalogSource.
 	SecretRef *corev1.ObjectReference `json:"secretRef,omitempty"`
 	// Configuration parameters to access the helm-repo defined in the CatalogSource
 	ConfigMapRef *corev1.ObjectReference `json:"configMapRef,omitempty"`
-	// InsecureSkipVerify is used to skip repo server's TLS certificate verification
+	// InsecureSkipVerify is used to skip repo server's TLS certificate verification and the ssh host key
+	// verification of git sources
 	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	// Verify enables the verification of the helm repo chart provenance (.prov) file,
+	// the chart is not installed or upgraded when the verification fails
+	Verify *ChartVerification `json:"verify,omitempty"`
+}
+
+//ValuesReferenceKind kinds of objects the values can be taken from
+type ValuesReferenceKind string
+
+const (
+	// ConfigMapValuesKind values taken from a ConfigMap
+	ConfigMapValuesKind ValuesReferenceKind = "ConfigMap"
+	// SecretValuesKind values taken from a Secret
+	SecretValuesKind ValuesReferenceKind = "Secret"
+	// DefaultValuesKey is the key holding the values when ValuesKey is not set
+	DefaultValuesKey = "values.yaml"
+)
+
+//ValuesReference references a ConfigMap or a Secret of the HelmRelease namespace holding values
+type ValuesReference struct {
+	// Kind of the values object, ConfigMap or Secret
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	Kind ValuesReferenceKind `json:"kind"`
+	// Name of the values object
+	Name string `json:"name"`
+	// ValuesKey is the key of the values object holding the values, defaults to values.yaml
+	// +kubebuilder:default=values.yaml
+	ValuesKey string `json:"valuesKey,omitempty"`
+	// TargetPath is the dot separated path (e.g. image.tag) the value of ValuesKey is set at,
+	// when empty the value of ValuesKey is parsed as a values yaml
+	TargetPath string `json:"targetPath,omitempty"`
+	// Optional skips the reference when the values object or the key does not exist
+	Optional bool `json:"optional,omitempty"`
 }
 
+//Remediation enables the rollback of the failed upgrades to the last deployed revision
+type Remediation struct {
+	// Retries is the number of failed upgrades before the release is rolled back, 0 rolls back after the
+	// first failure. The failures are counted since the last successful upgrade.
+	// +kubebuilder:validation:Minimum=0
+	Retries int `json:"retries,omitempty"`
+}
+
+//ReleaseTest runs the test hooks of the chart after the installs and the upgrades
+type ReleaseTest struct {
+	// Timeout of each test hook, defaults to the Timeout of the HelmRelease or 5m
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// Rollback rolls back the upgrades whose tests fail to the last deployed revision
+	Rollback bool `json:"rollback,omitempty"`
+}
+
+//DriftDetection compares the resources of the deployed release with their live objects periodically
+type DriftDetection struct {
+	// Interval between the drift detections, defaults to 10m
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Correct re-creates the deleted resources and patches the modified ones back to the release manifest
+	Correct bool `json:"correct,omitempty"`
+}
+
+//Retry overrides the retry backoff of the operator for the failed reconciles of the HelmRelease
+type Retry struct {
+	// BaseDelay is the delay before the first retry, it doubles with each consecutive failed attempt
+	BaseDelay *metav1.Duration `json:"baseDelay,omitempty"`
+	// MaxDelay caps the delay between the retries
+	MaxDelay *metav1.Duration `json:"maxDelay,omitempty"`
+}
+
+//CRDPolicy is how the CustomResourceDefinitions of the chart are handled
+type CRDPolicy string
+
+const (
+	// CRDPolicyCreate creates the CRDs of the crds directory of the chart on install, the helm default
+	CRDPolicyCreate CRDPolicy = "Create"
+	// CRDPolicyCreateReplace also replaces the existing CRDs of the crds directory on install and upgrade
+	CRDPolicyCreateReplace CRDPolicy = "CreateReplace"
+	// CRDPolicySkip does not create the CRDs of the crds directory
+	CRDPolicySkip CRDPolicy = "Skip"
+	// CRDPolicyKeepOnUninstall creates the CRDs like Create and removes all the CRDs from the helm storage and
+	// the status, so they are not deleted by an uninstall or the rollback of a failed install
+	CRDPolicyKeepOnUninstall CRDPolicy = "KeepOnUninstall"
+)
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // HelmRelease is the Schema for the subscriptionreleases API
 // +k8s:openapi-gen=true
 // +kubebuilder:resource:scope=Namespaced
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Chart",type="string",JSONPath=".status.deployedRelease.chartName"
+// +kubebuilder:printcolumn:name="Version",type="string",JSONPath=".status.deployedRelease.chartVersion"
+// +kubebuilder:printcolumn:name="Revision",type="integer",JSONPath=".status.deployedRelease.revision"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 type HelmRelease struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	Repo HelmReleaseRepo `json:"repo,omitempty"`
 
+	// ValuesFrom are merged in order, the values of Spec are merged last and take precedence
+	ValuesFrom []ValuesReference `json:"valuesFrom,omitempty"`
+
+	// OverrideValues are key.path=value overrides in the helm --set format, they are applied after Spec
+	OverrideValues map[string]string `json:"overrideValues,omitempty"`
+
+	// Remediation rolls back the failed upgrades, they are retried with a backoff when it is not set
+	Remediation *Remediation `json:"remediation,omitempty"`
+
+	// MaxHistory is the number of release revisions kept in the helm storage, 0 keeps all of them
+	// +kubebuilder:validation:Minimum=0
+	MaxHistory int `json:"maxHistory,omitempty"`
+
+	// Wait waits for the workloads of the release to be ready before marking the install or upgrade successful,
+	// the Ready condition reports whether they became ready within the Timeout
+	Wait bool `json:"wait,omitempty"`
+
+	// WaitForJobs also waits for the jobs of the release to complete, it implies Wait
+	WaitForJobs bool `json:"waitForJobs,omitempty"`
+
+	// Timeout of the helm hooks and of the wait for the workloads, defaults to 5m when waiting
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// Test runs the test hooks of the chart after the installs and the upgrades, the TestsPassed condition
+	// reports their result
+	Test *ReleaseTest `json:"test,omitempty"`
+
+	// DriftDetection reports the resources of the deployed release modified or deleted outside of helm in the
+	// Drifted condition and optionally corrects them
+	DriftDetection *DriftDetection `json:"driftDetection,omitempty"`
+
+	// Retry overrides the retry backoff of the operator, the delay applies to the download, release and
+	// uninstall errors alike
+	Retry *Retry `json:"retry,omitempty"`
+
+	// ResyncInterval reconciles the deployed release periodically, it overrides the resync interval of the operator
+	ResyncInterval *metav1.Duration `json:"resyncInterval,omitempty"`
+
+	// OmitManifest stores only the digest and the inventory of the manifest of the deployed release in the status
+	// instead of the whole manifest, for the charts whose manifest weighs on the object size limit
+	OmitManifest bool `json:"omitManifest,omitempty"`
+
+	// CRDPolicy is how the CustomResourceDefinitions of the chart are handled, defaults to KeepOnUninstall for
+	// the HelmReleases of a MultiClusterHub and to Create otherwise
+	// +kubebuilder:validation:Enum=Create;CreateReplace;Skip;KeepOnUninstall
+	CRDPolicy CRDPolicy `json:"crdPolicy,omitempty"`
+
 	Spec   HelmAppSpec   `json:"spec,omitempty"`
 	Status HelmAppStatus `json:"status,omitempty"`
 }
@@ -154,8 +315,67 @@ type HelmAppCondition struct {
 }
 
 type HelmAppRelease struct {
-	Name     string `json:"name,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Manifest is the rendered manifest of the release, it is not stored when OmitManifest is set
 	Manifest string `json:"manifest,omitempty"`
+	// ManifestDigest is the sha256 digest of the rendered manifest of the release
+	ManifestDigest string `json:"manifestDigest,omitempty"`
+	// Inventory lists the resources of the release
+	Inventory []HelmAppResource `json:"inventory,omitempty"`
+	// Commit is the git commit SHA the release was deployed from
+	Commit string `json:"commit,omitempty"`
+	// ChartName is the name of the deployed chart
+	ChartName string `json:"chartName,omitempty"`
+	// ChartVersion is the version of the deployed chart
+	ChartVersion string `json:"chartVersion,omitempty"`
+	// AppVersion is the version of the application of the deployed chart
+	AppVersion string `json:"appVersion,omitempty"`
+	// Revision is the helm revision number of the release
+	Revision int `json:"revision,omitempty"`
+	// FirstDeployed is when the first revision of the release was deployed
+	FirstDeployed *metav1.Time `json:"firstDeployed,omitempty"`
+	// LastDeployed is when the revision of the release was deployed
+	LastDeployed *metav1.Time `json:"lastDeployed,omitempty"`
+	// Source is the url the chart of the release was downloaded from
+	Source string `json:"source,omitempty"`
+}
+
+//HelmAppResource is a resource of the deployed release
+type HelmAppResource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// ResourcePolicy is the helm.sh/resource-policy annotation of the resource, the resources with the keep
+	// policy are not deleted on uninstall
+	ResourcePolicy string `json:"resourcePolicy,omitempty"`
+}
+
+//HelmAppDriftedResource is a resource of the deployed release whose live object differs from the release manifest
+type HelmAppDriftedResource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// Reason of the drift: Modified or Missing
+	Reason string `json:"reason"`
+}
+
+//HelmAppUpgradeTarget identifies the HelmRelease generation, chart revision and values an upgrade was attempted with
+type HelmAppUpgradeTarget struct {
+	Generation int64 `json:"generation"`
+	// Revision is the chart version, or the git commit SHA for the git sources
+	Revision string `json:"revision,omitempty"`
+	// ValuesDigest is the sha256 digest of the values of the release
+	ValuesDigest string `json:"valuesDigest,omitempty"`
+}
+
+//HelmAppTestResult is the result of the last run of a test hook of the chart
+type HelmAppTestResult struct {
+	// Name of the test hook
+	Name string `json:"name"`
+	// Phase of the test hook: Succeeded, Failed or Unknown when it did not run
+	Phase string `json:"phase"`
 }
 
 const (
@@ -163,6 +383,10 @@ const (
 	ConditionDeployed       HelmAppConditionType = "Deployed"
 	ConditionReleaseFailed  HelmAppConditionType = "ReleaseFailed"
 	ConditionIrreconcilable HelmAppConditionType = "Irreconcilable"
+	ConditionVerified       HelmAppConditionType = "Verified"
+	ConditionReady          HelmAppConditionType = "Ready"
+	ConditionTestsPassed    HelmAppConditionType = "TestsPassed"
+	ConditionDrifted        HelmAppConditionType = "Drifted"
 
 	StatusTrue    ConditionStatus = "True"
 	StatusFalse   ConditionStatus = "False"
@@ -175,11 +399,50 @@ const (
 	ReasonUpgradeError        HelmAppConditionReason = "UpgradeError"
 	ReasonReconcileError      HelmAppConditionReason = "ReconcileError"
 	ReasonUninstallError      HelmAppConditionReason = "UninstallError"
+	ReasonDigestMismatch      HelmAppConditionReason = "DigestMismatch"
+	ReasonVerificationSuccess HelmAppConditionReason = "VerificationSuccessful"
+	ReasonVerificationError   HelmAppConditionReason = "VerificationError"
+	ReasonValidationError     HelmAppConditionReason = "ValidationError"
+	ReasonRollbackSuccessful  HelmAppConditionReason = "RollbackSuccessful"
+	ReasonRollbackError       HelmAppConditionReason = "RollbackError"
+	ReasonReleaseReady        HelmAppConditionReason = "ReleaseReady"
+	ReasonReleaseNotReady     HelmAppConditionReason = "ReleaseNotReady"
+	ReasonTestsSuccessful     HelmAppConditionReason = "TestsSuccessful"
+	ReasonTestsError          HelmAppConditionReason = "TestsError"
+	ReasonNoDrift             HelmAppConditionReason = "NoDrift"
+	ReasonDriftDetected       HelmAppConditionReason = "DriftDetected"
+	ReasonDriftCorrected      HelmAppConditionReason = "DriftCorrected"
+	ReasonDriftDetectionError HelmAppConditionReason = "DriftDetectionError"
 )
 
 type HelmAppStatus struct {
 	Conditions      []HelmAppCondition `json:"conditions"`
 	DeployedRelease *HelmAppRelease    `json:"deployedRelease,omitempty"`
+	// ResolvedVersion is the chart version selected from the helm repo or the oci registry for Repo.Version
+	ResolvedVersion string `json:"resolvedVersion,omitempty"`
+	// ResolvedCommit is the git commit SHA the chart was last downloaded from
+	ResolvedCommit string `json:"resolvedCommit,omitempty"`
+	// ResolvedURL is the url the chart was last downloaded from
+	ResolvedURL string `json:"resolvedURL,omitempty"`
+	// ObservedGeneration is the generation of the HelmRelease last reconciled
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastAttemptedRevision is the chart version, or the git commit SHA for the git sources, of the last
+	// install or upgrade attempt
+	LastAttemptedRevision string `json:"lastAttemptedRevision,omitempty"`
+	// LastAppliedRevision is the chart version, or the git commit SHA for the git sources, of the last
+	// successful install or upgrade
+	LastAppliedRevision string `json:"lastAppliedRevision,omitempty"`
+	// UpgradeFailures is the number of failed upgrades since the last successful upgrade
+	UpgradeFailures int `json:"upgradeFailures,omitempty"`
+	// RolledBackTarget is the target of the upgrade rolled back by the remediation, the upgrade is not attempted
+	// again until the generation, the chart revision or the values of the HelmRelease change
+	RolledBackTarget *HelmAppUpgradeTarget `json:"rolledBackTarget,omitempty"`
+	// TestResults are the results of the test hooks run after the last install or upgrade
+	TestResults []HelmAppTestResult `json:"testResults,omitempty"`
+	// DriftedResources are the resources of the deployed release found drifted by the last drift detection
+	DriftedResources []HelmAppDriftedResource `json:"driftedResources,omitempty"`
+	// Attempts is the number of consecutive failed reconciles, it is reset by a successful reconcile
+	Attempts int `json:"attempts,omitempty"`
 }
 
 func (s *HelmAppStatus) ToMap() (map[string]interface{}, error) {
@@ -22,9 +22,52 @@ import (
 	"github.com/ghodss/yaml"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChartVerification) DeepCopyInto(out *ChartVerification) {
+	*out = *in
+	if in.KeyringSecretRef != nil {
+		in, out := &in.KeyringSecretRef, &out.KeyringSecretRef
+		*out = new(corev1.ObjectReference)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChartVerification.
+func (in *ChartVerification) DeepCopy() *ChartVerification {
+	if in == nil {
+		return nil
+	}
+	out := new(ChartVerification)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DriftDetection) DeepCopyInto(out *DriftDetection) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DriftDetection.
+func (in *DriftDetection) DeepCopy() *DriftDetection {
+	if in == nil {
+		return nil
+	}
+	out := new(DriftDetection)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Git) DeepCopyInto(out *Git) {
 	*out = *in
@@ -33,6 +76,11 @@ func (in *Git) DeepCopyInto(out *Git) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.PollInterval != nil {
+		in, out := &in.PollInterval, &out.PollInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 	return
 }
 
@@ -54,6 +102,11 @@ func (in *GitHub) DeepCopyInto(out *GitHub) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.PollInterval != nil {
+		in, out := &in.PollInterval, &out.PollInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 	return
 }
 
@@ -84,9 +137,38 @@ func (in *HelmAppCondition) DeepCopy() *HelmAppCondition {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmAppDriftedResource) DeepCopyInto(out *HelmAppDriftedResource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmAppDriftedResource.
+func (in *HelmAppDriftedResource) DeepCopy() *HelmAppDriftedResource {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmAppDriftedResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HelmAppRelease) DeepCopyInto(out *HelmAppRelease) {
 	*out = *in
+	if in.Inventory != nil {
+		in, out := &in.Inventory, &out.Inventory
+		*out = make([]HelmAppResource, len(*in))
+		copy(*out, *in)
+	}
+	if in.FirstDeployed != nil {
+		in, out := &in.FirstDeployed, &out.FirstDeployed
+		*out = (*in).DeepCopy()
+	}
+	if in.LastDeployed != nil {
+		in, out := &in.LastDeployed, &out.LastDeployed
+		*out = (*in).DeepCopy()
+	}
 	return
 }
 
@@ -100,6 +182,22 @@ func (in *HelmAppRelease) DeepCopy() *HelmAppRelease {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmAppResource) DeepCopyInto(out *HelmAppResource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmAppResource.
+func (in *HelmAppResource) DeepCopy() *HelmAppResource {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmAppResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HelmAppStatus) DeepCopyInto(out *HelmAppStatus) {
 	*out = *in
@@ -113,8 +211,23 @@ func (in *HelmAppStatus) DeepCopyInto(out *HelmAppStatus) {
 	if in.DeployedRelease != nil {
 		in, out := &in.DeployedRelease, &out.DeployedRelease
 		*out = new(HelmAppRelease)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RolledBackTarget != nil {
+		in, out := &in.RolledBackTarget, &out.RolledBackTarget
+		*out = new(HelmAppUpgradeTarget)
 		**out = **in
 	}
+	if in.TestResults != nil {
+		in, out := &in.TestResults, &out.TestResults
+		*out = make([]HelmAppTestResult, len(*in))
+		copy(*out, *in)
+	}
+	if in.DriftedResources != nil {
+		in, out := &in.DriftedResources, &out.DriftedResources
+		*out = make([]HelmAppDriftedResource, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -128,12 +241,86 @@ func (in *HelmAppStatus) DeepCopy() *HelmAppStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmAppTestResult) DeepCopyInto(out *HelmAppTestResult) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmAppTestResult.
+func (in *HelmAppTestResult) DeepCopy() *HelmAppTestResult {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmAppTestResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmAppUpgradeTarget) DeepCopyInto(out *HelmAppUpgradeTarget) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmAppUpgradeTarget.
+func (in *HelmAppUpgradeTarget) DeepCopy() *HelmAppUpgradeTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmAppUpgradeTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HelmRelease) DeepCopyInto(out *HelmRelease) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Repo.DeepCopyInto(&out.Repo)
+	if in.ValuesFrom != nil {
+		in, out := &in.ValuesFrom, &out.ValuesFrom
+		*out = make([]ValuesReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.OverrideValues != nil {
+		in, out := &in.OverrideValues, &out.OverrideValues
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Remediation != nil {
+		in, out := &in.Remediation, &out.Remediation
+		*out = new(Remediation)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Test != nil {
+		in, out := &in.Test, &out.Test
+		*out = new(ReleaseTest)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DriftDetection != nil {
+		in, out := &in.DriftDetection, &out.DriftDetection
+		*out = new(DriftDetection)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Retry != nil {
+		in, out := &in.Retry, &out.Retry
+		*out = new(Retry)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResyncInterval != nil {
+		in, out := &in.ResyncInterval, &out.ResyncInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 	if in.Spec != nil {
 		// Modified after auto gen
 		byt, err := yaml.Marshal(in.Spec)
@@ -214,6 +401,11 @@ func (in *HelmReleaseRepo) DeepCopyInto(out *HelmReleaseRepo) {
 		*out = new(corev1.ObjectReference)
 		**out = **in
 	}
+	if in.Verify != nil {
+		in, out := &in.Verify, &out.Verify
+		*out = new(ChartVerification)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -248,6 +440,90 @@ func (in *HelmRepo) DeepCopy() *HelmRepo {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OCI) DeepCopyInto(out *OCI) {
+	*out = *in
+	if in.Urls != nil {
+		in, out := &in.Urls, &out.Urls
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OCI.
+func (in *OCI) DeepCopy() *OCI {
+	if in == nil {
+		return nil
+	}
+	out := new(OCI)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReleaseTest) DeepCopyInto(out *ReleaseTest) {
+	*out = *in
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReleaseTest.
+func (in *ReleaseTest) DeepCopy() *ReleaseTest {
+	if in == nil {
+		return nil
+	}
+	out := new(ReleaseTest)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Remediation) DeepCopyInto(out *Remediation) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Remediation.
+func (in *Remediation) DeepCopy() *Remediation {
+	if in == nil {
+		return nil
+	}
+	out := new(Remediation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Retry) DeepCopyInto(out *Retry) {
+	*out = *in
+	if in.BaseDelay != nil {
+		in, out := &in.BaseDelay, &out.BaseDelay
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxDelay != nil {
+		in, out := &in.MaxDelay, &out.MaxDelay
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Retry.
+func (in *Retry) DeepCopy() *Retry {
+	if in == nil {
+		return nil
+	}
+	out := new(Retry)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Source) DeepCopyInto(out *Source) {
 	*out = *in
@@ -266,6 +542,11 @@ func (in *Source) DeepCopyInto(out *Source) {
 		*out = new(HelmRepo)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.OCI != nil {
+		in, out := &in.OCI, &out.OCI
+		*out = new(OCI)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -278,3 +559,19 @@ func (in *Source) DeepCopy() *Source {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValuesReference) DeepCopyInto(out *ValuesReference) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValuesReference.
+func (in *ValuesReference) DeepCopy() *ValuesReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ValuesReference)
+	in.DeepCopyInto(out)
+	return out
+}
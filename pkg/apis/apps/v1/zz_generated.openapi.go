@@ -61,6 +61,105 @@ func schema_pkg_apis_apps_v1_HelmRelease(ref common.ReferenceCallback) common.Op
 							Ref: ref("github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.HelmReleaseRepo"),
 						},
 					},
+					"valuesFrom": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ValuesFrom are merged in order, the values of Spec are merged last and take precedence",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.ValuesReference"),
+									},
+								},
+							},
+						},
+					},
+					"overrideValues": {
+						SchemaProps: spec.SchemaProps{
+							Description: "OverrideValues are key.path=value overrides in the helm --set format, they are applied after Spec",
+							Type:        []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"remediation": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Remediation rolls back the failed upgrades, they are retried with a backoff when it is not set",
+							Ref:         ref("github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.Remediation"),
+						},
+					},
+					"maxHistory": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MaxHistory is the number of release revisions kept in the helm storage, 0 keeps all of them",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"wait": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Wait waits for the workloads of the release to be ready before marking the install or upgrade successful, the Ready condition reports whether they became ready within the Timeout",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"waitForJobs": {
+						SchemaProps: spec.SchemaProps{
+							Description: "WaitForJobs also waits for the jobs of the release to complete, it implies Wait",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"timeout": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Timeout of the helm hooks and of the wait for the workloads, defaults to 5m when waiting",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"test": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Test runs the test hooks of the chart after the installs and the upgrades, the TestsPassed condition reports their result",
+							Ref:         ref("github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.ReleaseTest"),
+						},
+					},
+					"driftDetection": {
+						SchemaProps: spec.SchemaProps{
+							Description: "DriftDetection reports the resources of the deployed release modified or deleted outside of helm in the Drifted condition and optionally corrects them",
+							Ref:         ref("github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.DriftDetection"),
+						},
+					},
+					"retry": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Retry overrides the retry backoff of the operator, the delay applies to the download, release and uninstall errors alike",
+							Ref:         ref("github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.Retry"),
+						},
+					},
+					"resyncInterval": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ResyncInterval reconciles the deployed release periodically, it overrides the resync interval of the operator",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"omitManifest": {
+						SchemaProps: spec.SchemaProps{
+							Description: "OmitManifest stores only the digest and the inventory of the manifest of the deployed release in the status instead of the whole manifest, for the charts whose manifest weighs on the object size limit",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"crdPolicy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CRDPolicy is how the CustomResourceDefinitions of the chart are handled, defaults to KeepOnUninstall for the HelmReleases of a MultiClusterHub and to Create otherwise",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 					"spec": {
 						SchemaProps: spec.SchemaProps{
 							Ref: ref("github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.HelmAppSpec"),
@@ -75,7 +174,7 @@ func schema_pkg_apis_apps_v1_HelmRelease(ref common.ReferenceCallback) common.Op
 			},
 		},
 		Dependencies: []string{
-			"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.HelmAppSpec", "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.HelmAppStatus", "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.HelmReleaseRepo", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+			"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.DriftDetection", "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.HelmAppSpec", "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.HelmAppStatus", "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.HelmReleaseRepo", "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.ReleaseTest", "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.Remediation", "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.Retry", "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.ValuesReference", "k8s.io/apimachinery/pkg/apis/meta/v1.Duration", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
 	}
 }
 
@@ -101,14 +200,14 @@ func schema_pkg_apis_apps_v1_HelmReleaseRepo(ref common.ReferenceCallback) commo
 					},
 					"version": {
 						SchemaProps: spec.SchemaProps{
-							Description: "Version is the chart version",
+							Description: "Version is the chart version. For helm repos it can also be a semver range (e.g. ~1.4), in which case the highest matching version of the repo index is installed and upgraded to periodically",
 							Type:        []string{"string"},
 							Format:      "",
 						},
 					},
 					"digest": {
 						SchemaProps: spec.SchemaProps{
-							Description: "Digest is the helm repo chart digest",
+							Description: "Digest is the helm repo chart sha256 digest, the downloaded chart is rejected when it does not match",
 							Type:        []string{"string"},
 							Format:      "",
 						},
@@ -127,15 +226,21 @@ func schema_pkg_apis_apps_v1_HelmReleaseRepo(ref common.ReferenceCallback) commo
 					},
 					"insecureSkipVerify": {
 						SchemaProps: spec.SchemaProps{
-							Description: "InsecureSkipVerify is used to skip repo server's TLS certificate verification",
+							Description: "InsecureSkipVerify is used to skip repo server's TLS certificate verification and the ssh host key verification of git sources",
 							Type:        []string{"boolean"},
 							Format:      "",
 						},
 					},
+					"verify": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Verify enables the verification of the helm repo chart provenance (.prov) file, the chart is not installed or upgraded when the verification fails",
+							Ref:         ref("github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.ChartVerification"),
+						},
+					},
 				},
 			},
 		},
 		Dependencies: []string{
-			"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.Source", "k8s.io/api/core/v1.ObjectReference"},
+			"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.ChartVerification", "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1.Source", "k8s.io/api/core/v1.ObjectReference"},
 	}
 }
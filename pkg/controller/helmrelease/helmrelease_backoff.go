@@ -0,0 +1,100 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helmrelease
+
+import (
+	"time"
+
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+)
+
+// Backoff delays the retries of a class of errors, the delay starts at BaseDelay and doubles with each
+// consecutive failed attempt up to MaxDelay
+type Backoff struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var (
+	// DownloadBackoff delays the retries of the chart download and of the release manager creation errors
+	DownloadBackoff = Backoff{BaseDelay: time.Minute, MaxDelay: time.Minute * 30}
+	// ReleaseBackoff delays the retries of the install, upgrade and rollback errors
+	ReleaseBackoff = Backoff{BaseDelay: time.Minute, MaxDelay: time.Minute * 15}
+	// UninstallBackoff delays the retries of the uninstall errors and the checks of the deletion of the
+	// release resources
+	UninstallBackoff = Backoff{BaseDelay: time.Second * 15, MaxDelay: time.Minute * 5}
+	// ResyncInterval reconciles the deployed releases periodically, 0 disables the resync
+	ResyncInterval time.Duration
+)
+
+// retryResult counts a failed attempt in the status of the HelmRelease and requeues it after the delay of
+// the backoff. The failure is not returned to the controller: its rate limiter would requeue the HelmRelease
+// instead, with a delay shared by all the errors, kept in memory and ignoring the Retry of the HelmRelease. The
+// attempts counted in the status keep the delay across the restarts of the operator.
+func (r *ReconcileHelmRelease) retryResult(instance *appv1.HelmRelease, backoff Backoff) reconcile.Result {
+	instance.Status.Attempts++
+
+	if err := r.updateResourceStatus(instance); err != nil {
+		// the next delay is then computed from the attempts of the last saved status
+		klog.Error("Failed to update the status of HelmRelease ", helmreleaseNsn(instance), " ", err)
+	}
+
+	delay := retryDelay(instance, backoff)
+
+	klog.Info("Requeue HelmRelease ", helmreleaseNsn(instance), " after ", delay,
+		" attempt=", instance.Status.Attempts)
+
+	return reconcile.Result{RequeueAfter: delay}
+}
+
+// retryDelay returns the delay of the backoff after the failed attempts of the HelmRelease, its Retry
+// overrides the delays of the backoff
+func retryDelay(hr *appv1.HelmRelease, backoff Backoff) time.Duration {
+	if hr.Retry != nil {
+		if hr.Retry.BaseDelay != nil {
+			backoff.BaseDelay = hr.Retry.BaseDelay.Duration
+		}
+
+		if hr.Retry.MaxDelay != nil {
+			backoff.MaxDelay = hr.Retry.MaxDelay.Duration
+		}
+	}
+
+	delay := backoff.BaseDelay
+
+	for attempt := 1; attempt < hr.Status.Attempts && delay < backoff.MaxDelay; attempt++ {
+		delay *= 2
+	}
+
+	if delay > backoff.MaxDelay {
+		delay = backoff.MaxDelay
+	}
+
+	return delay
+}
+
+// resyncInterval returns the interval of the periodic reconcile of the deployed release, 0 when it is disabled
+func resyncInterval(hr *appv1.HelmRelease) time.Duration {
+	if hr.ResyncInterval != nil {
+		return hr.ResyncInterval.Duration
+	}
+
+	return ResyncInterval
+}
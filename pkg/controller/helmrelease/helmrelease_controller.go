@@ -24,23 +24,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/ghodss/yaml"
+	"github.com/prometheus/client_golang/prometheus"
 	"helm.sh/helm/v3/pkg/kube"
+	rspb "helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/releaseutil"
 	"helm.sh/helm/v3/pkg/storage/driver"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/klog"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
@@ -48,12 +51,31 @@ import (
 	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
 	"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/release"
 	helmoperator "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/release"
+	"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/utils"
 )
 
 const (
 	finalizer = "uninstall-helm-release"
 
-	defaultMaxConcurrent = 10
+	// versionConstraintResyncPeriod is how often the helm repo index is re-read when Repo.Version is a semver range
+	versionConstraintResyncPeriod = time.Minute * 10
+
+	// defaultWaitTimeout is the timeout of the wait for the workloads when HelmRelease.Timeout is not set
+	defaultWaitTimeout = time.Minute * 5
+
+	// defaultDriftDetectionInterval is the drift detection interval when DriftDetection.Interval is not set
+	defaultDriftDetectionInterval = time.Minute * 10
+)
+
+var (
+	// MaxConcurrentReconciles is the number of HelmReleases reconciled concurrently
+	MaxConcurrentReconciles = 10
+	// ChartsDir is the directory where the charts are downloaded and expanded, a temporary directory is
+	// created once for the process when it is not set
+	ChartsDir string
+	// WatchNamespaces are the namespaces the manager cache is restricted to, all the namespaces when empty. The
+	// watches not served by the manager cache are restricted to them as well.
+	WatchNamespaces []string
 )
 
 // Add creates a new HelmRelease Controller and adds it to the Manager. The Manager will set fields on the Controller
@@ -64,28 +86,26 @@ func Add(mgr manager.Manager) error {
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileHelmRelease{mgr}
+	return &ReconcileHelmRelease{
+		Manager:    mgr,
+		restMapper: mgr.GetRESTMapper(),
+		events:     newEventRecorder(mgr.GetEventRecorderFor("helmrelease-controller")),
+	}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
 func add(mgr manager.Manager, r reconcile.Reconciler) error {
-	chartsDir := os.Getenv(appv1.ChartsDir)
-	if chartsDir == "" {
-		chartsDir, err := ioutil.TempDir("/tmp", "charts")
-		if err != nil {
-			return err
-		}
-
-		err = os.Setenv(appv1.ChartsDir, chartsDir)
-		if err != nil {
-			return err
-		}
+	dir, err := chartsDir()
+	if err != nil {
+		return err
 	}
 
-	klog.Info("The MaxConcurrentReconciles is set to: ", defaultMaxConcurrent)
+	klog.Info("The charts directory is set to: ", dir)
+	klog.Info("The MaxConcurrentReconciles is set to: ", MaxConcurrentReconciles)
 
 	// Create a new controller
-	c, err := controller.New("helmrelease-controller", mgr, controller.Options{Reconciler: r, MaxConcurrentReconciles: defaultMaxConcurrent})
+	c, err := controller.New("helmrelease-controller", mgr, controller.Options{Reconciler: r,
+		MaxConcurrentReconciles: MaxConcurrentReconciles})
 	if err != nil {
 		return err
 	}
@@ -96,7 +116,19 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
-	return nil
+	// Watch for changes to the release resources, the watches are added as the releases are deployed
+	if rec, ok := r.(*ReconcileHelmRelease); ok {
+		rec.watches = newDependentWatches(c, mgr.GetRESTMapper(), WatchNamespaces)
+	}
+
+	// Count the HelmReleases by condition when the metrics are scraped
+	if err := metrics.Registry.Register(&releasesCollector{client: mgr.GetClient()}); err != nil &&
+		!errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		return err
+	}
+
+	// Watch for changes to the ConfigMaps and Secrets referenced in valuesFrom
+	return addValuesFromWatches(mgr, c)
 }
 
 // blank assignment to verify that ReconcileHelmRelease implements reconcile.Reconciler
@@ -105,6 +137,15 @@ var _ reconcile.Reconciler = &ReconcileHelmRelease{}
 // ReconcileHelmRelease reconciles a HelmRelease object
 type ReconcileHelmRelease struct {
 	manager.Manager
+
+	// watches enqueues the HelmReleases on the changes of their release resources, it is set with the controller
+	watches *dependentWatches
+
+	// events emits the events of the release lifecycle
+	events *eventRecorder
+
+	// restMapper resolves the namespaces of the release resources in the inventory
+	restMapper meta.RESTMapper
 }
 
 // Reconcile reads that state of the cluster for a HelmRelease object and makes changes based on the state read
@@ -123,6 +164,9 @@ func (r *ReconcileHelmRelease) Reconcile(request reconcile.Request) (reconcile.R
 		klog.Info("Ignorable error. Failed to find HelmRelease, most likely it has been uninstalled: ",
 			helmreleaseNsn(instance), " ", err)
 
+		deleteOperationMetrics(request.Namespace, request.Name)
+		r.events.forget(request.Namespace, request.Name)
+
 		return reconcile.Result{}, nil
 	}
 	if err != nil {
@@ -130,51 +174,59 @@ func (r *ReconcileHelmRelease) Reconcile(request reconcile.Request) (reconcile.R
 		return reconcile.Result{}, err
 	}
 
-	if instance.Repo.Source == nil {
-		klog.Error("Failed to detect Repo.Source from HelmRelease ", helmreleaseNsn(instance), ". Setting requeue to false.")
-		//TODO set error status here
+	// the defaulting webhook persists the defaults when it is enabled, they are applied on every reconcile otherwise
+	instance.Default()
 
-		return reconcile.Result{Requeue: false}, nil
-	}
-
-	// setting the nil spec to "":"" allows helmrelease to reconcile with default chart values.
-	if instance.Spec == nil && instance.GetDeletionTimestamp() == nil {
-		spec := make(map[string]interface{})
+	instance.Status.ObservedGeneration = instance.GetGeneration()
 
-		err := yaml.Unmarshal([]byte("{\"\":\"\"}"), &spec)
-		if err != nil {
-			klog.Error("Failed to unmarshal default spec: ",
-				helmreleaseNsn(instance), " ", err)
-
-			return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
-		}
+	// the validating webhook rejects the invalid HelmReleases when it is enabled, the HelmReleases created before
+	// the validation was added are reported by a warning event and their deployed release is left untouched
+	if errs := utils.ValidateHelmRelease(instance); len(errs) > 0 && instance.GetDeletionTimestamp() == nil {
+		klog.Error("Invalid HelmRelease ", helmreleaseNsn(instance), ": ", errs.ToAggregate(), ". Setting requeue to false.")
 
-		instance.Spec = spec
+		instance.Status.SetCondition(appv1.HelmAppCondition{
+			Type:    appv1.ConditionIrreconcilable,
+			Status:  appv1.StatusTrue,
+			Reason:  appv1.ReasonValidationError,
+			Message: errs.ToAggregate().Error(),
+		})
+		_ = r.updateResourceStatus(instance)
 
-		err = r.GetClient().Update(context.TODO(), instance)
-		if err != nil {
-			klog.Error("Failed to update HelmRelease with default spec: ",
-				helmreleaseNsn(instance), " ", err)
+		r.events.event(instance, corev1.EventTypeWarning, string(appv1.ReasonValidationError), errs.ToAggregate().Error())
 
-			return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
-		}
+		return reconcile.Result{Requeue: false}, nil
 	}
 
+	resolvedVersion, resolvedCommit := instance.Status.ResolvedVersion, instance.Status.ResolvedCommit
+
 	// handles the download of the chart as well
 	helmOperatorManagerFactory, err := r.newHelmOperatorManagerFactory(instance)
 	if err != nil {
 		klog.Error("Failed to create new HelmOperatorManagerFactory: ",
 			helmreleaseNsn(instance), " ", err)
 
+		reason := appv1.ReasonReconcileError
+
+		switch {
+		case errors.Is(err, utils.ErrDigestMismatch):
+			reason = appv1.ReasonDigestMismatch
+		case errors.Is(err, utils.ErrProvenanceVerification):
+			reason = appv1.ReasonVerificationError
+		}
+
 		instance.Status.SetCondition(appv1.HelmAppCondition{
 			Type:    appv1.ConditionIrreconcilable,
 			Status:  appv1.StatusTrue,
-			Reason:  appv1.ReasonReconcileError,
+			Reason:  reason,
 			Message: err.Error(),
 		})
-		_ = r.updateResourceStatus(instance)
+		r.events.event(instance, corev1.EventTypeWarning, string(reason), "failed to download the chart: "+err.Error())
 
-		return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+		return r.retryResult(instance, DownloadBackoff), nil
+	}
+
+	if instance.Status.ResolvedVersion != resolvedVersion || instance.Status.ResolvedCommit != resolvedCommit {
+		r.events.event(instance, corev1.EventTypeNormal, eventReasonChartDownloaded, chartDownloadedMessage(instance))
 	}
 
 	manager, err := r.newHelmOperatorManager(instance, request, helmOperatorManagerFactory)
@@ -188,15 +240,14 @@ func (r *ReconcileHelmRelease) Reconcile(request reconcile.Request) (reconcile.R
 			Reason:  appv1.ReasonReconcileError,
 			Message: err.Error(),
 		})
-		_ = r.updateResourceStatus(instance)
+		r.events.event(instance, corev1.EventTypeWarning, string(appv1.ReasonReconcileError), err.Error())
 
-		return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+		return r.retryResult(instance, DownloadBackoff), nil
 	}
 
-	// hack for MultiClusterHub to remove CRD outside of Helm/HelmRelease's control
-	// TODO introduce a generic annotation to trigger this feature
-	if err := r.hackMultiClusterHubRemoveCRDReferences(instance, manager.GetActionConfig()); err != nil {
-		klog.Error("Failed to hackMultiClusterHubRemoveCRDReferences: ", err)
+	// the KeepOnUninstall CRD policy removes the CRDs outside of Helm/HelmRelease's control
+	if err := r.keepCRDsOnUninstall(instance, manager.GetActionConfig()); err != nil {
+		klog.Error("Failed to remove the CRD references: ", err)
 
 		return reconcile.Result{}, err
 	}
@@ -223,15 +274,20 @@ func (r *ReconcileHelmRelease) Reconcile(request reconcile.Request) (reconcile.R
 			Reason:  appv1.ReasonReconcileError,
 			Message: err.Error(),
 		})
-		_ = r.updateResourceStatus(instance)
-
-		klog.Info("Requeue HelmRelease after one minute ")
+		r.events.event(instance, corev1.EventTypeWarning, string(appv1.ReasonReconcileError), err.Error())
 
-		return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+		return r.retryResult(instance, ReleaseBackoff), nil
 	}
 
 	instance.Status.RemoveCondition(appv1.ConditionIrreconcilable)
 
+	return r.reconcileRelease(instance, manager)
+}
+
+// reconcileRelease installs or upgrades the synced release of the HelmRelease, an upgrade rolled back by the
+// remediation is not attempted again until its target changes
+func (r *ReconcileHelmRelease) reconcileRelease(
+	instance *appv1.HelmRelease, manager helmoperator.Manager) (reconcile.Result, error) {
 	if !manager.IsInstalled() {
 		return r.install(instance, manager)
 	}
@@ -241,21 +297,40 @@ func (r *ReconcileHelmRelease) Reconcile(request reconcile.Request) (reconcile.R
 		controllerutil.AddFinalizer(instance, finalizer)
 		if err := r.updateResource(instance); err != nil {
 			klog.Error("Failed to add uninstall finalizer to ", helmreleaseNsn(instance))
-			return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+			return r.retryResult(instance, ReleaseBackoff), nil
 		}
 	}
 
 	if manager.IsUpgradeRequired() {
-		return r.upgrade(instance, manager)
+		target := upgradeTarget(instance, manager)
+
+		rolledBack := instance.Status.RolledBackTarget
+		if rolledBack == nil || *rolledBack != target {
+			if rolledBack != nil {
+				klog.Info("The target of the rolled back upgrade changed, upgrading ", helmreleaseNsn(instance))
+
+				instance.Status.RolledBackTarget = nil
+				instance.Status.UpgradeFailures = 0
+			}
+
+			return r.upgrade(instance, manager)
+		}
+
+		klog.Info("Skipping the rolled back upgrade until the HelmRelease or its values change ",
+			helmreleaseNsn(instance))
+	} else {
+		// If a change is made to the CR spec that causes a release failure, a
+		// ConditionReleaseFailed is added to the status conditions. If that change
+		// is then reverted to its previous state, the operator will stop
+		// attempting the release and will resume reconciling. In this case, we
+		// need to remove the ConditionReleaseFailed because the failing release is
+		// no longer being attempted.
+		instance.Status.RemoveCondition(appv1.ConditionReleaseFailed)
+		instance.Status.RolledBackTarget = nil
+		instance.Status.UpgradeFailures = 0
 	}
 
-	// If a change is made to the CR spec that causes a release failure, a
-	// ConditionReleaseFailed is added to the status conditions. If that change
-	// is then reverted to its previous state, the operator will stop
-	// attempting the release and will resume reconciling. In this case, we
-	// need to remove the ConditionReleaseFailed because the failing release is
-	// no longer being attempted.
-	instance.Status.RemoveCondition(appv1.ConditionReleaseFailed)
+	r.detectDrift(instance, manager)
 
 	return r.ensureStatusReasonPopulated(instance, manager)
 }
@@ -312,7 +387,23 @@ func (r *ReconcileHelmRelease) install(instance *appv1.HelmRelease, manager helm
 
 	klog.Info("Installing Release ", helmreleaseNsn(instance))
 
-	installedRelease, err := manager.InstallRelease(context.TODO())
+	instance.Status.LastAttemptedRevision = chartRevision(instance)
+
+	wait, waitForJobs, timeout := waitSettings(instance)
+
+	started := time.Now()
+
+	var installedRelease *rspb.Release
+
+	err := replaceCRDs(instance, manager)
+	if err == nil {
+		installedRelease, err = manager.InstallRelease(context.TODO(), release.InstallWait(wait, waitForJobs, timeout),
+			release.InstallSkipCRDs(instance.CRDPolicy == appv1.CRDPolicySkip))
+	}
+
+	observeOperation(instance, operationInstall, started, err)
+	setReadyCondition(instance, err)
+
 	if err != nil {
 		klog.Error("Failed to install HelmRelease ",
 			helmreleaseNsn(instance), " ", err)
@@ -322,15 +413,14 @@ func (r *ReconcileHelmRelease) install(instance *appv1.HelmRelease, manager helm
 			Reason:  appv1.ReasonInstallError,
 			Message: err.Error(),
 		})
-		_ = r.updateResourceStatus(instance)
+		r.events.event(instance, corev1.EventTypeWarning, string(appv1.ReasonInstallError), err.Error())
 
 		if rollbackByUninstall && installedRelease != nil {
-			// hack for MultiClusterHub to remove CRD outside of Helm/HelmRelease's control
-			// TODO introduce a generic annotation to trigger this feature
-			if errRemoveCRDs := r.hackMultiClusterHubRemoveCRDReferences(instance, manager.GetActionConfig()); errRemoveCRDs != nil {
-				klog.Error("Failed to hackMultiClusterHubRemoveCRDReferences: ", errRemoveCRDs)
+			// the KeepOnUninstall CRD policy removes the CRDs outside of Helm/HelmRelease's control
+			if errRemoveCRDs := r.keepCRDsOnUninstall(instance, manager.GetActionConfig()); errRemoveCRDs != nil {
+				klog.Error("Failed to remove the CRD references: ", errRemoveCRDs)
 
-				return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+				return r.retryResult(instance, ReleaseBackoff), nil
 			}
 
 			klog.Info("Failed to install HelmRelease and the installedRelease response is not nil. Proceed to uninstall ",
@@ -347,15 +437,14 @@ func (r *ReconcileHelmRelease) install(instance *appv1.HelmRelease, manager helm
 					Reason:  appv1.ReasonInstallError,
 					Message: "failed installation " + err.Error() + " and failed uninstall rollback " + errUninstall.Error(),
 				})
-				_ = r.updateResourceStatus(instance)
 
-				return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+				return r.retryResult(instance, ReleaseBackoff), nil
 			}
 
 			klog.Info("Uninstalled Release for install failure ", helmreleaseNsn(instance))
 		}
 
-		return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+		return r.retryResult(instance, ReleaseBackoff), nil
 	}
 
 	instance.Status.RemoveCondition(appv1.ConditionReleaseFailed)
@@ -364,10 +453,12 @@ func (r *ReconcileHelmRelease) install(instance *appv1.HelmRelease, manager helm
 	controllerutil.AddFinalizer(instance, finalizer)
 	if err := r.updateResource(instance); err != nil {
 		klog.Error("Failed to add uninstall finalizer to ", helmreleaseNsn(instance), " ", err)
-		return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+		return r.retryResult(instance, ReleaseBackoff), nil
 	}
 
 	klog.Info("Installed HelmRelease ", helmreleaseNsn(instance))
+	r.events.event(instance, corev1.EventTypeNormal, string(appv1.ReasonInstallSuccessful),
+		fmt.Sprintf("installed revision %d of release %s", installedRelease.Version, installedRelease.Name))
 
 	message := ""
 	if installedRelease.Info != nil {
@@ -379,70 +470,83 @@ func (r *ReconcileHelmRelease) install(instance *appv1.HelmRelease, manager helm
 		Reason:  appv1.ReasonInstallSuccessful,
 		Message: message,
 	})
-	instance.Status.DeployedRelease = &appv1.HelmAppRelease{
-		Name:     installedRelease.Name,
-		Manifest: installedRelease.Manifest,
-	}
+	instance.Status.DeployedRelease = deployedRelease(instance, installedRelease, r.restMapper)
+	instance.Status.LastAppliedRevision = chartRevision(instance)
+
+	// a failed test does not uninstall the release, the TestsPassed condition reports it
+	_ = runTests(instance, manager)
+
+	instance.Status.Attempts = 0
+
 	err = r.updateResourceStatus(instance)
 	if err != nil {
 		klog.Error("Failed to update resource status for HelmRelease ",
 			helmreleaseNsn(instance), " ", err)
 	}
 
-	return reconcile.Result{}, err
+	r.watchDependentResources(instance)
+
+	return resyncResult(instance), err
 }
 
 func (r *ReconcileHelmRelease) upgrade(instance *appv1.HelmRelease, manager helmoperator.Manager) (reconcile.Result, error) {
 	klog.Info("Upgrading Release ", helmreleaseNsn(instance))
 
+	instance.Status.LastAttemptedRevision = chartRevision(instance)
+
 	force := hasHelmUpgradeForceAnnotation(instance)
-	_, upgradedRelease, err := manager.UpgradeRelease(context.TODO(), release.ForceUpgrade(force))
+	wait, waitForJobs, timeout := waitSettings(instance)
+
+	started := time.Now()
+
+	var upgradedRelease *rspb.Release
+
+	err := replaceCRDs(instance, manager)
+	if err == nil {
+		_, upgradedRelease, err = manager.UpgradeRelease(context.TODO(), release.ForceUpgrade(force),
+			release.UpgradeMaxHistory(instance.MaxHistory), release.UpgradeWait(wait, waitForJobs, timeout))
+	}
+
+	observeOperation(instance, operationUpgrade, started, err)
+	setReadyCondition(instance, err)
+
 	if err != nil {
 		klog.Error("Failed to upgrade HelmRelease ", helmreleaseNsn(instance), " ", err)
+
+		instance.Status.UpgradeFailures++
 		instance.Status.SetCondition(appv1.HelmAppCondition{
 			Type:    appv1.ConditionReleaseFailed,
 			Status:  appv1.StatusTrue,
 			Reason:  appv1.ReasonUpgradeError,
 			Message: err.Error(),
 		})
-		_ = r.updateResourceStatus(instance)
+		r.events.event(instance, corev1.EventTypeWarning, string(appv1.ReasonUpgradeError), err.Error())
 
-		// hack for MultiClusterHub to remove CRD outside of Helm/HelmRelease's control
-		// TODO introduce a generic annotation to trigger this feature
-		if errRemoveCRDs := r.hackMultiClusterHubRemoveCRDReferences(instance, manager.GetActionConfig()); errRemoveCRDs != nil {
-			klog.Error("Failed to hackMultiClusterHubRemoveCRDReferences: ", errRemoveCRDs)
+		// the KeepOnUninstall CRD policy removes the CRDs outside of Helm/HelmRelease's control
+		if errRemoveCRDs := r.keepCRDsOnUninstall(instance, manager.GetActionConfig()); errRemoveCRDs != nil {
+			klog.Error("Failed to remove the CRD references: ", errRemoveCRDs)
 
-			return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+			return r.retryResult(instance, ReleaseBackoff), nil
 		}
 
-		if upgradedRelease != nil {
-			klog.Info("Failed to upgrade HelmRelease and the upgradedRelease response is not nil. Proceed to rollback ",
-				helmreleaseNsn(instance))
-
-			errRollback := manager.RollbackRelease(context.TODO())
-			if errRollback != nil && !errors.Is(errRollback, driver.ErrReleaseNotFound) {
-				klog.Error("Failed to rollback HelmRelease ",
-					helmreleaseNsn(instance), " ", err)
-
-				instance.Status.SetCondition(appv1.HelmAppCondition{
-					Type:    appv1.ConditionReleaseFailed,
-					Status:  appv1.StatusTrue,
-					Reason:  appv1.ReasonUpgradeError,
-					Message: "failed upgrade " + err.Error() + " and failed rollback: " + errRollback.Error(),
-				})
-				_ = r.updateResourceStatus(instance)
-
-				return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
-			}
-
-			klog.Info("Rollbacked Release for upgrade failure ", helmreleaseNsn(instance))
+		if instance.Remediation != nil && instance.Status.UpgradeFailures > instance.Remediation.Retries {
+			return r.rollback(instance, manager, fmt.Errorf("%d failed upgrades: %w", instance.Status.UpgradeFailures, err))
 		}
 
-		return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+		return r.retryResult(instance, ReleaseBackoff), nil
 	}
+	instance.Status.UpgradeFailures = 0
+	instance.Status.RolledBackTarget = nil
 	instance.Status.RemoveCondition(appv1.ConditionReleaseFailed)
 
 	klog.Info("Upgraded HelmRelease ", "force=", force, " for ", helmreleaseNsn(instance))
+	r.events.event(instance, corev1.EventTypeNormal, string(appv1.ReasonUpgradeSuccessful),
+		fmt.Sprintf("upgraded release %s to revision %d", upgradedRelease.Name, upgradedRelease.Version))
+
+	if err := runTests(instance, manager); err != nil && instance.Test.Rollback {
+		return r.rollback(instance, manager, fmt.Errorf("failed tests: %w", err))
+	}
+
 	message := ""
 	if upgradedRelease.Info != nil {
 		message = upgradedRelease.Info.Notes
@@ -453,17 +557,293 @@ func (r *ReconcileHelmRelease) upgrade(instance *appv1.HelmRelease, manager helm
 		Reason:  appv1.ReasonUpgradeSuccessful,
 		Message: message,
 	})
-	instance.Status.DeployedRelease = &appv1.HelmAppRelease{
-		Name:     upgradedRelease.Name,
-		Manifest: upgradedRelease.Manifest,
+	instance.Status.DeployedRelease = deployedRelease(instance, upgradedRelease, r.restMapper)
+	instance.Status.LastAppliedRevision = chartRevision(instance)
+	instance.Status.Attempts = 0
+
+	err = r.updateResourceStatus(instance)
+	if err != nil {
+		klog.Error("Failed to update resource status for HelmRelease ",
+			helmreleaseNsn(instance), " ", err)
+	}
+
+	r.watchDependentResources(instance)
+
+	return resyncResult(instance), err
+}
+
+// runTests runs the test hooks of the release when the HelmRelease enables them and reports their results,
+// it returns the error of the failed tests
+func runTests(instance *appv1.HelmRelease, manager helmoperator.Manager) error {
+	if instance.Test == nil {
+		instance.Status.TestResults = nil
+		instance.Status.RemoveCondition(appv1.ConditionTestsPassed)
+
+		return nil
+	}
+
+	klog.Info("Testing Release ", helmreleaseNsn(instance))
+
+	started := time.Now()
+
+	testedRelease, err := manager.TestRelease(context.TODO(), release.TestTimeout(testTimeout(instance)))
+	instance.Status.TestResults = testResults(testedRelease, started)
+
+	if err != nil {
+		klog.Error("Failed to test HelmRelease ", helmreleaseNsn(instance), " ", err)
+
+		instance.Status.SetCondition(appv1.HelmAppCondition{
+			Type:    appv1.ConditionTestsPassed,
+			Status:  appv1.StatusFalse,
+			Reason:  appv1.ReasonTestsError,
+			Message: err.Error(),
+		})
+
+		return err
+	}
+
+	klog.Info("Tested Release ", helmreleaseNsn(instance))
+
+	instance.Status.SetCondition(appv1.HelmAppCondition{
+		Type:   appv1.ConditionTestsPassed,
+		Status: appv1.StatusTrue,
+		Reason: appv1.ReasonTestsSuccessful,
+	})
+
+	return nil
+}
+
+// testTimeout returns the timeout of each test hook of the HelmRelease
+func testTimeout(hr *appv1.HelmRelease) time.Duration {
+	if hr.Test.Timeout != nil {
+		return hr.Test.Timeout.Duration
+	}
+
+	if hr.Timeout != nil {
+		return hr.Timeout.Duration
+	}
+
+	return defaultWaitTimeout
+}
+
+// testResults returns the results of the test hooks of the release, the hooks which did not run since started
+// because a previous one failed are in the Unknown phase
+func testResults(rel *rspb.Release, started time.Time) []appv1.HelmAppTestResult {
+	if rel == nil {
+		return nil
+	}
+
+	results := []appv1.HelmAppTestResult{}
+
+	for _, hook := range rel.Hooks {
+		for _, event := range hook.Events {
+			if event != rspb.HookTest {
+				continue
+			}
+
+			phase := hook.LastRun.Phase
+			if phase == "" || hook.LastRun.StartedAt.Time.Before(started) {
+				phase = rspb.HookPhaseUnknown
+			}
+
+			results = append(results, appv1.HelmAppTestResult{Name: hook.Name, Phase: phase.String()})
+
+			break
+		}
+	}
+
+	return results
+}
+
+// watchDependentResources watches the kinds of the resources of the deployed release so the HelmRelease is
+// reconciled when one of them is deleted or changed
+func (r *ReconcileHelmRelease) watchDependentResources(instance *appv1.HelmRelease) {
+	if r.watches == nil || instance.Status.DeployedRelease == nil {
+		return
+	}
+
+	manifest, err := releaseManifest(instance.Status.DeployedRelease)
+	if err == nil {
+		err = r.watches.watchRelease(instance, manifest)
+	}
+
+	if err != nil {
+		klog.Error("Failed to watch the release resources of HelmRelease ", helmreleaseNsn(instance), " ", err)
+	}
+}
+
+// detectDrift compares the resources of the deployed release with their live objects when the HelmRelease
+// enables the drift detection and reports the drifted ones, they are corrected when DriftDetection.Correct is set.
+// Without drift detection, the missing resources are re-created when the release resources are watched.
+func (r *ReconcileHelmRelease) detectDrift(instance *appv1.HelmRelease, manager helmoperator.Manager) {
+	if instance.DriftDetection == nil {
+		instance.Status.DriftedResources = nil
+		instance.Status.RemoveCondition(appv1.ConditionDrifted)
+
+		r.createMissingResources(instance, manager)
+
+		return
 	}
+
+	klog.V(1).Info("Detecting drift of Release ", helmreleaseNsn(instance))
+
+	drifted, err := manager.DetectDrift(context.TODO(), instance.DriftDetection.Correct)
+	instance.Status.DriftedResources = drifted
+
+	switch {
+	case err != nil:
+		klog.Error("Failed to detect drift of HelmRelease ", helmreleaseNsn(instance), " ", err)
+
+		instance.Status.SetCondition(appv1.HelmAppCondition{
+			Type:    appv1.ConditionDrifted,
+			Status:  appv1.StatusUnknown,
+			Reason:  appv1.ReasonDriftDetectionError,
+			Message: err.Error(),
+		})
+		r.events.event(instance, corev1.EventTypeWarning, string(appv1.ReasonDriftDetectionError), err.Error())
+	case len(drifted) == 0:
+		instance.Status.SetCondition(appv1.HelmAppCondition{
+			Type:   appv1.ConditionDrifted,
+			Status: appv1.StatusFalse,
+			Reason: appv1.ReasonNoDrift,
+		})
+	case instance.DriftDetection.Correct:
+		klog.Info("Corrected ", len(drifted), " drifted resources of HelmRelease ", helmreleaseNsn(instance))
+
+		instance.Status.SetCondition(appv1.HelmAppCondition{
+			Type:    appv1.ConditionDrifted,
+			Status:  appv1.StatusFalse,
+			Reason:  appv1.ReasonDriftCorrected,
+			Message: fmt.Sprintf("corrected %d drifted resources", len(drifted)),
+		})
+		r.events.event(instance, corev1.EventTypeNormal, string(appv1.ReasonDriftCorrected), driftMessage("corrected", drifted))
+	default:
+		klog.Info("Detected ", len(drifted), " drifted resources of HelmRelease ", helmreleaseNsn(instance))
+
+		instance.Status.SetCondition(appv1.HelmAppCondition{
+			Type:    appv1.ConditionDrifted,
+			Status:  appv1.StatusTrue,
+			Reason:  appv1.ReasonDriftDetected,
+			Message: fmt.Sprintf("%d resources drifted from the release manifest", len(drifted)),
+		})
+		r.events.event(instance, corev1.EventTypeWarning, string(appv1.ReasonDriftDetected), driftMessage("drifted", drifted))
+	}
+}
+
+// createMissingResources re-creates the deleted resources of the deployed release when the release resources
+// are watched, the HelmRelease is reconciled on their deletion
+func (r *ReconcileHelmRelease) createMissingResources(instance *appv1.HelmRelease, manager helmoperator.Manager) {
+	if r.watches == nil {
+		return
+	}
+
+	created, err := manager.CreateMissingResources(context.TODO())
+	if err != nil {
+		klog.Error("Failed to create the missing resources of HelmRelease ", helmreleaseNsn(instance), " ", err)
+		r.events.event(instance, corev1.EventTypeWarning, string(appv1.ReasonReconcileError), err.Error())
+
+		return
+	}
+
+	if len(created) > 0 {
+		klog.Info("Created ", len(created), " missing resources of HelmRelease ", helmreleaseNsn(instance))
+		r.events.event(instance, corev1.EventTypeNormal, string(appv1.ReasonDriftCorrected), driftMessage("created", created))
+	}
+}
+
+// waitSettings returns whether the helm actions wait for the workloads and the jobs of the release and
+// their timeout
+func waitSettings(hr *appv1.HelmRelease) (wait, waitForJobs bool, timeout time.Duration) {
+	wait = hr.Wait || hr.WaitForJobs
+
+	if hr.Timeout != nil {
+		timeout = hr.Timeout.Duration
+	} else if wait {
+		timeout = defaultWaitTimeout
+	}
+
+	return wait, hr.WaitForJobs, timeout
+}
+
+// setReadyCondition reports whether the workloads of the release became ready during the install or the
+// upgrade, the Ready condition is only set when the HelmRelease waits for them
+func setReadyCondition(hr *appv1.HelmRelease, err error) {
+	if !hr.Wait && !hr.WaitForJobs {
+		hr.Status.RemoveCondition(appv1.ConditionReady)
+		return
+	}
+
+	if err != nil {
+		hr.Status.SetCondition(appv1.HelmAppCondition{
+			Type:    appv1.ConditionReady,
+			Status:  appv1.StatusFalse,
+			Reason:  appv1.ReasonReleaseNotReady,
+			Message: err.Error(),
+		})
+
+		return
+	}
+
+	hr.Status.SetCondition(appv1.HelmAppCondition{
+		Type:   appv1.ConditionReady,
+		Status: appv1.StatusTrue,
+		Reason: appv1.ReasonReleaseReady,
+	})
+}
+
+// rollback rolls back the release to its last deployed revision after a failed upgrade or failed tests. The
+// target of the upgrade is recorded so the upgrade is only attempted again when the HelmRelease, its chart
+// revision or its values change.
+func (r *ReconcileHelmRelease) rollback(instance *appv1.HelmRelease, manager helmoperator.Manager,
+	cause error) (reconcile.Result, error) {
+	klog.Info("Rolling back Release ", helmreleaseNsn(instance), " after ", cause)
+
+	started := time.Now()
+	err := manager.RollbackRelease(context.TODO(), release.RollbackMaxHistory(instance.MaxHistory))
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		err = nil
+	}
+
+	observeOperation(instance, operationRollback, started, err)
+
+	if err != nil {
+		klog.Error("Failed to rollback HelmRelease ", helmreleaseNsn(instance), " ", err)
+
+		instance.Status.SetCondition(appv1.HelmAppCondition{
+			Type:    appv1.ConditionReleaseFailed,
+			Status:  appv1.StatusTrue,
+			Reason:  appv1.ReasonRollbackError,
+			Message: cause.Error() + " and failed rollback: " + err.Error(),
+		})
+		r.events.event(instance, corev1.EventTypeWarning, string(appv1.ReasonRollbackError),
+			cause.Error()+" and failed rollback: "+err.Error())
+
+		return r.retryResult(instance, ReleaseBackoff), nil
+	}
+
+	klog.Info("Rolled back Release ", helmreleaseNsn(instance))
+	r.events.event(instance, corev1.EventTypeNormal, string(appv1.ReasonRollbackSuccessful), "rolled back after "+cause.Error())
+
+	instance.Status.SetCondition(appv1.HelmAppCondition{
+		Type:    appv1.ConditionReleaseFailed,
+		Status:  appv1.StatusTrue,
+		Reason:  appv1.ReasonRollbackSuccessful,
+		Message: "rolled back after " + cause.Error(),
+	})
+
+	target := upgradeTarget(instance, manager)
+	instance.Status.RolledBackTarget = &target
+	instance.Status.Attempts = 0
+
 	err = r.updateResourceStatus(instance)
 	if err != nil {
 		klog.Error("Failed to update resource status for HelmRelease ",
 			helmreleaseNsn(instance), " ", err)
 	}
 
-	return reconcile.Result{}, err
+	// the status update does not requeue the HelmRelease, it is resynced to see a change of the upgrade target
+	// from the polled source and to keep detecting drift
+	return resyncResult(instance), err
 }
 
 func (r *ReconcileHelmRelease) uninstall(instance *appv1.HelmRelease, manager helmoperator.Manager) (reconcile.Result, error) {
@@ -475,33 +855,45 @@ func (r *ReconcileHelmRelease) uninstall(instance *appv1.HelmRelease, manager he
 
 	klog.Info("Uninstalling Release ", helmreleaseNsn(instance))
 
+	started := time.Now()
 	_, err := manager.UninstallRelease(context.TODO())
-	if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		err = nil
+	}
+
+	observeOperation(instance, operationUninstall, started, err)
+
+	if err != nil {
 		klog.Error("Failed to uninstall HelmRelease ", helmreleaseNsn(instance), " ", err)
-		r.updateUninstallResourceErrorStatus(instance, err)
+		setUninstallErrorCondition(instance, err)
+		r.events.event(instance, corev1.EventTypeWarning, string(appv1.ReasonUninstallError), err.Error())
 
-		return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+		return r.retryResult(instance, UninstallBackoff), nil
 	}
 
 	klog.Info("Uninstalled HelmRelease ", helmreleaseNsn(instance))
 
 	// no need to check for remaining resources when there is no DeployedRelease
 	// skip ahead to removing the finalizer and let the helmrelease terminate
-	if instance.Status.DeployedRelease == nil || instance.Status.DeployedRelease.Manifest == "" {
+	if instance.Status.DeployedRelease == nil ||
+		(instance.Status.DeployedRelease.Manifest == "" && len(instance.Status.DeployedRelease.Inventory) == 0) {
 		controllerutil.RemoveFinalizer(instance, finalizer)
 
 		if err := r.updateResource(instance); err != nil {
 			klog.Error("Failed to strip HelmRelease uninstall finalizer ", helmreleaseNsn(instance), " ", err)
 
-			return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+			return r.retryResult(instance, UninstallBackoff), nil
 		}
 
 		klog.Info("Removed finalizer from HelmRelease ", helmreleaseNsn(instance), " requeue after 1 minute")
+		r.events.event(instance, corev1.EventTypeNormal, eventReasonFinalizerRemoved, "removed finalizer "+finalizer)
+
+		removeReleaseCharts(instance)
 
 		return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
 	}
 
-	klog.Info("Checking to see if all the resources in Status.DeployedRelease.Manifest are deleted ",
+	klog.Info("Checking to see if all the resources in Status.DeployedRelease are deleted ",
 		helmreleaseNsn(instance))
 
 	instance.Status.RemoveCondition(appv1.ConditionReleaseFailed)
@@ -509,19 +901,28 @@ func (r *ReconcileHelmRelease) uninstall(instance *appv1.HelmRelease, manager he
 	caps, err := getCapabilities(manager.GetActionConfig())
 	if err != nil {
 		klog.Error("Failed to get API Capabilities to perform cleanup check ", helmreleaseNsn(instance), " ", err)
-		r.updateUninstallResourceErrorStatus(instance, err)
+		setUninstallErrorCondition(instance, err)
 
-		return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+		return r.retryResult(instance, UninstallBackoff), nil
+	}
+
+	// the manifest is rendered from the inventory when it is not stored in the status
+	manifest, err := releaseManifest(instance.Status.DeployedRelease)
+	if err != nil {
+		klog.Error("Corrupted release inventory for ", helmreleaseNsn(instance), " ", err)
+		setUninstallErrorCondition(instance, err)
+
+		return r.retryResult(instance, UninstallBackoff), nil
 	}
 
-	manifests := releaseutil.SplitManifests(instance.Status.DeployedRelease.Manifest)
+	manifests := releaseutil.SplitManifests(manifest)
 
 	_, files, err := releaseutil.SortManifests(manifests, caps.APIVersions, releaseutil.UninstallOrder)
 	if err != nil {
 		klog.Error("Corrupted release record for ", helmreleaseNsn(instance), " ", err)
-		r.updateUninstallResourceErrorStatus(instance, err)
+		setUninstallErrorCondition(instance, err)
 
-		return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+		return r.retryResult(instance, UninstallBackoff), nil
 	}
 
 	// do not delete resources that are annotated with the Helm resource policy 'keep'
@@ -533,9 +934,9 @@ func (r *ReconcileHelmRelease) uninstall(instance *appv1.HelmRelease, manager he
 	resources, err := manager.GetActionConfig().KubeClient.Build(strings.NewReader(builder.String()), false)
 	if err != nil {
 		klog.Error("Unable to build kubernetes objects for delete ", helmreleaseNsn(instance), " ", err)
-		r.updateUninstallResourceErrorStatus(instance, err)
+		setUninstallErrorCondition(instance, err)
 
-		return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+		return r.retryResult(instance, UninstallBackoff), nil
 	}
 
 	if len(resources) > 0 {
@@ -547,9 +948,9 @@ func (r *ReconcileHelmRelease) uninstall(instance *appv1.HelmRelease, manager he
 				}
 				klog.Error("Unable to get resource ", resource.Namespace, "/", resource.Name,
 					" for ", helmreleaseNsn(instance), " ", err)
-				r.updateUninstallResourceErrorStatus(instance, err)
+				setUninstallErrorCondition(instance, err)
 
-				return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+				return r.retryResult(instance, UninstallBackoff), nil
 			}
 
 			// found at least one resource that is not deleted then just delete everything again.
@@ -565,7 +966,7 @@ func (r *ReconcileHelmRelease) uninstall(instance *appv1.HelmRelease, manager he
 
 			message := "Failed to delete HelmRelease due to resource: " + gvk + " " +
 				resource.Namespace + "/" + resource.Name +
-				" is not deleted yet. Checking again after one minute."
+				" is not deleted yet. Checking again later."
 			klog.Error(message)
 			instance.Status.SetCondition(appv1.HelmAppCondition{
 				Type:    appv1.ConditionReleaseFailed,
@@ -573,14 +974,14 @@ func (r *ReconcileHelmRelease) uninstall(instance *appv1.HelmRelease, manager he
 				Reason:  appv1.ReasonUninstallError,
 				Message: message,
 			})
-			_ = r.updateResourceStatus(instance)
+			r.events.event(instance, corev1.EventTypeWarning, string(appv1.ReasonUninstallError), message)
 
-			return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+			return r.retryResult(instance, UninstallBackoff), nil
 		}
 	}
 
 	klog.Info("HelmRelease ", helmreleaseNsn(instance),
-		" all Status.DeployedRelease.Manifest resources are deleted/terminating")
+		" all Status.DeployedRelease resources are deleted/terminating")
 
 	instance.Status.RemoveCondition(appv1.ConditionReleaseFailed)
 	instance.Status.SetCondition(appv1.HelmAppCondition{
@@ -589,6 +990,8 @@ func (r *ReconcileHelmRelease) uninstall(instance *appv1.HelmRelease, manager he
 		Reason: appv1.ReasonUninstallSuccessful,
 	})
 	_ = r.updateResourceStatus(instance)
+	r.events.event(instance, corev1.EventTypeNormal, string(appv1.ReasonUninstallSuccessful),
+		"uninstalled release "+instance.GetName()+" and deleted its resources")
 
 	controllerutil.RemoveFinalizer(instance, finalizer)
 
@@ -596,22 +999,25 @@ func (r *ReconcileHelmRelease) uninstall(instance *appv1.HelmRelease, manager he
 		klog.Error("Failed to strip HelmRelease uninstall finalizer ",
 			helmreleaseNsn(instance), " ", err)
 
-		return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+		return r.retryResult(instance, UninstallBackoff), nil
 	}
 
+	r.events.event(instance, corev1.EventTypeNormal, eventReasonFinalizerRemoved, "removed finalizer "+finalizer)
+
+	removeReleaseCharts(instance)
+
 	// if everything goes well the next time the reconcile won't find the helmrelease anymore
 	// which will end the reconcile loop
 	return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
 }
 
-func (r *ReconcileHelmRelease) updateUninstallResourceErrorStatus(instance *appv1.HelmRelease, err error) {
+func setUninstallErrorCondition(instance *appv1.HelmRelease, err error) {
 	instance.Status.SetCondition(appv1.HelmAppCondition{
 		Type:    appv1.ConditionReleaseFailed,
 		Status:  appv1.StatusTrue,
 		Reason:  appv1.ReasonUninstallError,
 		Message: err.Error(),
 	})
-	_ = r.updateResourceStatus(instance)
 }
 
 func (r *ReconcileHelmRelease) ensureStatusReasonPopulated(
@@ -626,8 +1032,8 @@ func (r *ReconcileHelmRelease) ensureStatusReasonPopulated(
 			Reason:  appv1.ReasonReconcileError,
 			Message: err.Error(),
 		})
-		_ = r.updateResourceStatus(instance)
-		return reconcile.Result{RequeueAfter: time.Minute * 1}, nil
+
+		return r.retryResult(instance, ReleaseBackoff), nil
 	}
 	instance.Status.RemoveCondition(appv1.ConditionIrreconcilable)
 
@@ -645,17 +1051,201 @@ func (r *ReconcileHelmRelease) ensureStatusReasonPopulated(
 		Reason:  reason,
 		Message: message,
 	})
-	instance.Status.DeployedRelease = &appv1.HelmAppRelease{
-		Name:     expectedRelease.Name,
-		Manifest: expectedRelease.Manifest,
+	instance.Status.DeployedRelease = deployedRelease(instance, expectedRelease, r.restMapper)
+	instance.Status.Attempts = 0
+
+	// the revision of a rolled back upgrade is not applied
+	if instance.Status.RolledBackTarget == nil {
+		instance.Status.LastAppliedRevision = chartRevision(instance)
 	}
+
 	err = r.updateResourceStatus(instance)
 	if err != nil {
 		klog.Error("Failed to update resource status for HelmRelease ",
 			helmreleaseNsn(instance), " ", err)
 	}
 
-	return reconcile.Result{}, err
+	r.watchDependentResources(instance)
+
+	return resyncResult(instance), err
+}
+
+// resyncResult returns the result of a successful reconcile. HelmReleases with a semver range
+// as Repo.Version are requeued so newer matching chart versions in the helm repo get picked up,
+// git sources with a poll interval are requeued so new commits get picked up, HelmReleases
+// with drift detection are requeued at the drift detection interval and all of them are
+// requeued at the resync interval when it is set, whichever comes first.
+func resyncResult(hr *appv1.HelmRelease) reconcile.Result {
+	result := sourceResyncResult(hr)
+
+	if hr.DriftDetection != nil {
+		interval := defaultDriftDetectionInterval
+		if hr.DriftDetection.Interval != nil {
+			interval = hr.DriftDetection.Interval.Duration
+		}
+
+		if result.RequeueAfter == 0 || interval < result.RequeueAfter {
+			klog.V(1).Info("Requeue HelmRelease ", helmreleaseNsn(hr), " after ", interval, " to detect drift")
+
+			result = reconcile.Result{RequeueAfter: interval}
+		}
+	}
+
+	if interval := resyncInterval(hr); interval > 0 && (result.RequeueAfter == 0 || interval < result.RequeueAfter) {
+		klog.V(1).Info("Requeue HelmRelease ", helmreleaseNsn(hr), " after ", interval, " to resync")
+
+		result = reconcile.Result{RequeueAfter: interval}
+	}
+
+	return result
+}
+
+// sourceResyncResult returns the result of a successful reconcile polling the source of the chart
+func sourceResyncResult(hr *appv1.HelmRelease) reconcile.Result {
+	if hr.Repo.Source == nil {
+		return reconcile.Result{}
+	}
+
+	if pollInterval := gitPollInterval(hr.Repo.Source); pollInterval > 0 {
+		klog.V(1).Info("Requeue HelmRelease ", helmreleaseNsn(hr), " after ", pollInterval,
+			" to poll ", hr.Repo.Source.String())
+
+		return reconcile.Result{RequeueAfter: pollInterval}
+	}
+
+	if !strings.EqualFold(string(hr.Repo.Source.SourceType), string(appv1.HelmRepoSourceType)) ||
+		!utils.IsVersionConstraint(hr.Repo.Version) {
+		return reconcile.Result{}
+	}
+
+	klog.V(1).Info("Requeue HelmRelease ", helmreleaseNsn(hr), " after ", versionConstraintResyncPeriod,
+		" to resolve version ", hr.Repo.Version)
+
+	return reconcile.Result{RequeueAfter: versionConstraintResyncPeriod}
+}
+
+// gitPollInterval returns the poll interval of git and github sources, polling is disabled
+// when the source is pinned to a commit
+func gitPollInterval(source *appv1.Source) time.Duration {
+	switch strings.ToLower(string(source.SourceType)) {
+	case string(appv1.GitHubSourceType):
+		if source.GitHub != nil && source.GitHub.PollInterval != nil && source.GitHub.Commit == "" {
+			return source.GitHub.PollInterval.Duration
+		}
+	case string(appv1.GitSourceType):
+		if source.Git != nil && source.Git.PollInterval != nil && source.Git.Commit == "" {
+			return source.Git.PollInterval.Duration
+		}
+	}
+
+	return 0
+}
+
+// chartDownloadedMessage returns the message of the event of a newly resolved chart version or commit
+func chartDownloadedMessage(hr *appv1.HelmRelease) string {
+	message := "downloaded chart " + hr.Repo.ChartName
+
+	if hr.Status.ResolvedVersion != "" {
+		message += " version " + hr.Status.ResolvedVersion
+	}
+
+	if hr.Status.ResolvedCommit != "" {
+		message += " at commit " + hr.Status.ResolvedCommit
+	}
+
+	return message
+}
+
+// replaceCRDs creates and replaces the CRDs of the chart before an install or upgrade when the CRD policy of the
+// HelmRelease is CreateReplace
+func replaceCRDs(instance *appv1.HelmRelease, manager helmoperator.Manager) error {
+	if instance.CRDPolicy != appv1.CRDPolicyCreateReplace {
+		return nil
+	}
+
+	klog.Info("Replacing the CRDs of Release ", helmreleaseNsn(instance))
+
+	return manager.ReplaceCRDs(context.TODO())
+}
+
+// deployedRelease returns the status of a release deployed from the chart last downloaded for the HelmRelease.
+// The manifest is only kept with its digest and inventory when OmitManifest is not set or the inventory can not
+// be listed.
+func deployedRelease(hr *appv1.HelmRelease, rel *rspb.Release, restMapper meta.RESTMapper) *appv1.HelmAppRelease {
+	deployed := &appv1.HelmAppRelease{
+		Name:           rel.Name,
+		Manifest:       rel.Manifest,
+		ManifestDigest: manifestDigest(rel.Manifest),
+		Commit:         hr.Status.ResolvedCommit,
+		Revision:       rel.Version,
+		Source:         hr.Status.ResolvedURL,
+	}
+
+	inventory, err := releaseInventory(rel.Manifest, hr.GetNamespace(), restMapper)
+	if err != nil {
+		klog.Error("Failed to list the inventory of the release of HelmRelease ", helmreleaseNsn(hr), " ", err)
+	} else {
+		deployed.Inventory = inventory
+
+		if hr.OmitManifest {
+			deployed.Manifest = ""
+		}
+	}
+
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		deployed.ChartName = rel.Chart.Metadata.Name
+		deployed.ChartVersion = rel.Chart.Metadata.Version
+		deployed.AppVersion = rel.Chart.Metadata.AppVersion
+	}
+
+	if rel.Info != nil {
+		if !rel.Info.FirstDeployed.IsZero() {
+			firstDeployed := metav1.NewTime(rel.Info.FirstDeployed.Time)
+			deployed.FirstDeployed = &firstDeployed
+		}
+
+		if !rel.Info.LastDeployed.IsZero() {
+			lastDeployed := metav1.NewTime(rel.Info.LastDeployed.Time)
+			deployed.LastDeployed = &lastDeployed
+		}
+	}
+
+	return deployed
+}
+
+// upgradeTarget returns the generation, chart revision and values digest an upgrade of the HelmRelease targets
+func upgradeTarget(hr *appv1.HelmRelease, manager helmoperator.Manager) appv1.HelmAppUpgradeTarget {
+	return appv1.HelmAppUpgradeTarget{
+		Generation:   hr.GetGeneration(),
+		Revision:     chartRevision(hr),
+		ValuesDigest: manager.ValuesDigest(),
+	}
+}
+
+// chartRevision returns the revision of the chart last downloaded for the HelmRelease: the git commit SHA for the
+// git sources, the resolved chart version otherwise
+func chartRevision(hr *appv1.HelmRelease) string {
+	if hr.Status.ResolvedCommit != "" {
+		return hr.Status.ResolvedCommit
+	}
+
+	if hr.Status.ResolvedVersion != "" {
+		return hr.Status.ResolvedVersion
+	}
+
+	return hr.Repo.Version
+}
+
+// driftMessage returns the message of the drift events listing the drifted resources
+func driftMessage(verb string, drifted []appv1.HelmAppDriftedResource) string {
+	resources := make([]string, 0, len(drifted))
+
+	for _, resource := range drifted {
+		resources = append(resources, fmt.Sprintf("%s %s/%s (%s)", resource.Kind, resource.Namespace, resource.Name,
+			resource.Reason))
+	}
+
+	return fmt.Sprintf("%s %d resources: %s", verb, len(drifted), strings.Join(resources, ", "))
 }
 
 func helmreleaseNsn(hr *appv1.HelmRelease) string {
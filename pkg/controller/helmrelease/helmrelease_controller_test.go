@@ -15,20 +15,48 @@
 package helmrelease
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/onsi/gomega"
+	libhandler "github.com/operator-framework/operator-lib/handler"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"golang.org/x/net/context"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	rspb "helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+	helmoperator "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/release"
+	"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/utils"
 )
 
 var (
@@ -54,7 +82,7 @@ func TestReconcile(t *testing.T) {
 	c := mgr.GetClient()
 
 	rec := &ReconcileHelmRelease{
-		mgr,
+		Manager: mgr,
 	}
 
 	t.Log("Setup test reconcile")
@@ -836,3 +864,1004 @@ func Test_generateResourceListForHelm(t *testing.T) {
 	g.Expect(err).NotTo(gomega.HaveOccurred())
 	g.Expect(resourceList).NotTo(gomega.BeNil())
 }
+
+func TestResyncResult(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	instance := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "example-resync",
+			Namespace: helmReleaseNS,
+		},
+		Repo: appv1.HelmReleaseRepo{
+			Source: &appv1.Source{
+				SourceType: appv1.HelmRepoSourceType,
+				HelmRepo: &appv1.HelmRepo{
+					Urls: []string{"https://charts.example.com"},
+				},
+			},
+			ChartName: "subscription-release-test-1",
+			Version:   "0.1.0",
+		},
+	}
+
+	g.Expect(resyncResult(instance)).To(gomega.Equal(reconcile.Result{}))
+
+	instance.Repo.Version = "~0.1"
+	g.Expect(resyncResult(instance)).To(gomega.Equal(reconcile.Result{RequeueAfter: versionConstraintResyncPeriod}))
+
+	instance.Repo.Source = &appv1.Source{
+		SourceType: appv1.GitSourceType,
+		Git: &appv1.Git{
+			Urls:      []string{"https://github.com/open-cluster-management/multicloud-operators-subscription-release.git"},
+			ChartPath: "test/github/subscription-release-test-1",
+			Branch:    "main",
+		},
+	}
+	g.Expect(resyncResult(instance)).To(gomega.Equal(reconcile.Result{}))
+
+	instance.Repo.Source.Git.PollInterval = &metav1.Duration{Duration: time.Minute * 2}
+	g.Expect(resyncResult(instance)).To(gomega.Equal(reconcile.Result{RequeueAfter: time.Minute * 2}))
+
+	instance.Repo.Source.Git.Commit = "4c3f0a5"
+	g.Expect(resyncResult(instance)).To(gomega.Equal(reconcile.Result{}))
+
+	instance.ResyncInterval = &metav1.Duration{Duration: time.Hour}
+	g.Expect(resyncResult(instance)).To(gomega.Equal(reconcile.Result{RequeueAfter: time.Hour}))
+
+	instance.Repo.Source.Git.Commit = ""
+	g.Expect(resyncResult(instance)).To(gomega.Equal(reconcile.Result{RequeueAfter: time.Minute * 2}))
+}
+
+func TestRetryDelay(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	instance := &appv1.HelmRelease{}
+	backoff := Backoff{BaseDelay: time.Minute, MaxDelay: time.Minute * 5}
+
+	for attempts, delay := range []time.Duration{time.Minute, time.Minute, time.Minute * 2, time.Minute * 4,
+		time.Minute * 5, time.Minute * 5} {
+		instance.Status.Attempts = attempts
+		g.Expect(retryDelay(instance, backoff)).To(gomega.Equal(delay))
+	}
+
+	instance.Retry = &appv1.Retry{BaseDelay: &metav1.Duration{Duration: time.Second * 10}}
+	instance.Status.Attempts = 3
+	g.Expect(retryDelay(instance, backoff)).To(gomega.Equal(time.Second * 40))
+
+	instance.Retry.MaxDelay = &metav1.Duration{Duration: time.Second * 30}
+	g.Expect(retryDelay(instance, backoff)).To(gomega.Equal(time.Second * 30))
+}
+
+func TestDeployedRelease(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	instance := &appv1.HelmRelease{Repo: appv1.HelmReleaseRepo{Version: "^1.0.0"}}
+	g.Expect(chartRevision(instance)).To(gomega.Equal("^1.0.0"))
+
+	instance.Status.ResolvedVersion = "1.2.0"
+	instance.Status.ResolvedURL = "https://charts.example.com/example-1.2.0.tgz"
+	g.Expect(chartRevision(instance)).To(gomega.Equal("1.2.0"))
+
+	firstDeployed := helmtime.Unix(1600000000, 0)
+	lastDeployed := helmtime.Unix(1600003600, 0)
+	rel := &rspb.Release{
+		Name:     "example",
+		Manifest: "manifest",
+		Version:  3,
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{Name: "example", Version: "1.2.0", AppVersion: "2.0"},
+		},
+		Info: &rspb.Info{FirstDeployed: firstDeployed, LastDeployed: lastDeployed},
+	}
+
+	deployed := deployedRelease(instance, rel, nil)
+	g.Expect(deployed.Name).To(gomega.Equal("example"))
+	g.Expect(deployed.Manifest).To(gomega.Equal("manifest"))
+	g.Expect(deployed.ChartName).To(gomega.Equal("example"))
+	g.Expect(deployed.ChartVersion).To(gomega.Equal("1.2.0"))
+	g.Expect(deployed.AppVersion).To(gomega.Equal("2.0"))
+	g.Expect(deployed.Revision).To(gomega.Equal(3))
+	g.Expect(deployed.Source).To(gomega.Equal("https://charts.example.com/example-1.2.0.tgz"))
+	g.Expect(deployed.FirstDeployed.Time.Equal(firstDeployed.Time)).To(gomega.BeTrue())
+	g.Expect(deployed.LastDeployed.Time.Equal(lastDeployed.Time)).To(gomega.BeTrue())
+
+	// the git sources are identified by their commit
+	instance.Status.ResolvedCommit = "8f2a6c1"
+	g.Expect(chartRevision(instance)).To(gomega.Equal("8f2a6c1"))
+	g.Expect(deployedRelease(instance, &rspb.Release{Name: "example"}, nil).Commit).To(gomega.Equal("8f2a6c1"))
+}
+
+func TestReleaseInventory(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	manifest := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: example
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: example
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: example-kept
+  namespace: other
+  annotations:
+    helm.sh/resource-policy: keep
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: examples.example.com
+`
+
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	restMapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"},
+		meta.RESTScopeRoot)
+
+	instance := &appv1.HelmRelease{
+		ObjectMeta:   metav1.ObjectMeta{Name: "example", Namespace: helmReleaseNS},
+		OmitManifest: true,
+	}
+
+	deployed := deployedRelease(instance, &rspb.Release{Name: "example", Manifest: manifest}, restMapper)
+	g.Expect(deployed.Manifest).To(gomega.BeEmpty())
+	g.Expect(deployed.ManifestDigest).To(gomega.Equal(manifestDigest(manifest)))
+	g.Expect(deployed.ManifestDigest).To(gomega.HavePrefix("sha256:"))
+	g.Expect(deployed.Inventory).To(gomega.Equal([]appv1.HelmAppResource{
+		{APIVersion: "apps/v1", Kind: "Deployment", Namespace: helmReleaseNS, Name: "example"},
+		{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole", Name: "example"},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "other", Name: "example-kept", ResourcePolicy: "keep"},
+		{APIVersion: "apiextensions.k8s.io/v1", Kind: "CustomResourceDefinition", Name: "examples.example.com"},
+	}))
+
+	// the manifest rendered from the inventory lists the same resources
+	rendered, err := releaseManifest(deployed)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	inventory, err := releaseInventory(rendered, helmReleaseNS, nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(inventory).To(gomega.Equal(deployed.Inventory))
+
+	inventory, changed := stripInventoryCRDs(deployed.Inventory)
+	g.Expect(changed).To(gomega.BeTrue())
+	g.Expect(inventory).To(gomega.HaveLen(3))
+
+	_, changed = stripInventoryCRDs(inventory)
+	g.Expect(changed).To(gomega.BeFalse())
+
+	instance.OmitManifest = false
+	g.Expect(deployedRelease(instance, &rspb.Release{Name: "example", Manifest: manifest}, nil).Manifest).To(
+		gomega.Equal(manifest))
+}
+
+func TestGetValues(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	c := fake.NewFakeClientWithScheme(scheme.Scheme,
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "example-values", Namespace: helmReleaseNS},
+			Data: map[string]string{
+				appv1.DefaultValuesKey: "image:\n  repository: nginx\n  tag: \"1.0\"\nreplicas: 1\n",
+				"override.yaml":        "replicas: 2\n",
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "example-secret", Namespace: helmReleaseNS},
+			Data: map[string][]byte{
+				"password": []byte(`s,e=c[r]e\t`),
+			},
+		},
+	)
+
+	instance := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "example-values",
+			Namespace: helmReleaseNS,
+		},
+		ValuesFrom: []appv1.ValuesReference{
+			{Kind: appv1.ConfigMapValuesKind, Name: "example-values"},
+			{Kind: appv1.ConfigMapValuesKind, Name: "example-values", ValuesKey: "override.yaml"},
+			{Kind: appv1.SecretValuesKind, Name: "example-secret", ValuesKey: "password", TargetPath: "auth.password"},
+			{Kind: appv1.SecretValuesKind, Name: "example-missing", Optional: true},
+		},
+	}
+
+	g.Expect(indexValuesFrom(instance)).To(gomega.Equal([]string{
+		"ConfigMap/example-values", "ConfigMap/example-values", "Secret/example-secret", "Secret/example-missing"}))
+
+	values, err := getValues(c, instance, map[string]interface{}{
+		"image": map[string]interface{}{"tag": "2.0"},
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(values).To(gomega.Equal(map[string]interface{}{
+		"image":    map[string]interface{}{"repository": "nginx", "tag": "2.0"},
+		"replicas": float64(2),
+		"auth":     map[string]interface{}{"password": `s,e=c[r]e\t`},
+	}))
+
+	instance.OverrideValues = map[string]string{"image.repository": "registry.example.com/nginx", "replicas": "3"}
+
+	values, err = getValues(c, instance, map[string]interface{}{"replicas": 1})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(values["image"]).To(gomega.Equal(map[string]interface{}{"repository": "registry.example.com/nginx", "tag": "1.0"}))
+	g.Expect(values["replicas"]).To(gomega.Equal("3"))
+
+	instance.ValuesFrom = append(instance.ValuesFrom, appv1.ValuesReference{Kind: appv1.SecretValuesKind, Name: "example-missing"})
+
+	_, err = getValues(c, instance, nil)
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	instance.ValuesFrom = []appv1.ValuesReference{{Kind: appv1.ConfigMapValuesKind, Name: "example-values", ValuesKey: "missing"}}
+
+	_, err = getValues(c, instance, nil)
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	instance.ValuesFrom = []appv1.ValuesReference{
+		{Kind: appv1.SecretValuesKind, Name: "example-secret", ValuesKey: "password", TargetPath: "auth..password"},
+	}
+
+	_, err = getValues(c, instance, nil)
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestValuesFromPredicate(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	c := fake.NewFakeClientWithScheme(scheme.Scheme, &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-values", Namespace: helmReleaseNS},
+		ValuesFrom: []appv1.ValuesReference{{Kind: appv1.SecretValuesKind, Name: "example-secret"}},
+	})
+
+	p := valuesFromPredicate(c, appv1.SecretValuesKind)
+
+	referenced := &metav1.PartialObjectMetadata{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-secret", Namespace: helmReleaseNS, ResourceVersion: "1"},
+	}
+	g.Expect(p.Create(event.CreateEvent{Meta: referenced, Object: referenced})).To(gomega.BeTrue())
+
+	// the values objects of the namespaces without HelmRelease are filtered out
+	other := &metav1.PartialObjectMetadata{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-secret", Namespace: "default", ResourceVersion: "1"},
+	}
+	g.Expect(p.Create(event.CreateEvent{Meta: other, Object: other})).To(gomega.BeFalse())
+
+	// the resyncs are filtered out
+	g.Expect(p.Update(event.UpdateEvent{
+		MetaOld: referenced, ObjectOld: referenced, MetaNew: referenced, ObjectNew: referenced,
+	})).To(gomega.BeFalse())
+
+	updated := referenced.DeepCopy()
+	updated.ResourceVersion = "2"
+	g.Expect(p.Update(event.UpdateEvent{
+		MetaOld: referenced, ObjectOld: referenced, MetaNew: updated, ObjectNew: updated,
+	})).To(gomega.BeTrue())
+
+	requests := valuesFromMapper(c, appv1.SecretValuesKind)(handler.MapObject{Meta: updated, Object: updated})
+	g.Expect(requests).To(gomega.Equal([]reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: helmReleaseNS, Name: "example-values"}},
+	}))
+}
+
+func TestValuesFromInformerFactories(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	secret := func(namespace string) *metav1.PartialObjectMetadata {
+		return &metav1.PartialObjectMetadata{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: metav1.ObjectMeta{Name: "example-secret", Namespace: namespace},
+		}
+	}
+
+	metadataScheme := runtime.NewScheme()
+	metav1.AddMetaToScheme(metadataScheme)
+
+	metadataClient := metadatafake.NewSimpleMetadataClient(metadataScheme, secret(helmReleaseNS), secret("default"))
+
+	// the informers of a namespaced manager only list and watch its namespaces
+	factories := valuesFromInformerFactories(metadataClient, []string{helmReleaseNS})
+	g.Expect(factories).To(gomega.HaveLen(1))
+
+	informer := factories[0].ForResource(valuesFromResources[appv1.SecretValuesKind]).Informer()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	factories[0].Start(stop)
+	factories[0].WaitForCacheSync(stop)
+
+	g.Expect(informer.GetStore().ListKeys()).To(gomega.Equal([]string{helmReleaseNS + "/example-secret"}))
+
+	for _, action := range metadataClient.Actions() {
+		g.Expect(action.GetNamespace()).To(gomega.Equal(helmReleaseNS))
+	}
+
+	g.Expect(valuesFromInformerFactories(metadataClient, nil)).To(gomega.HaveLen(1))
+}
+
+// fakeReleaseManager returns the upgrade and test errors and records the upgrades and rollbacks
+type fakeReleaseManager struct {
+	helmoperator.Manager
+	upgradeErr      error
+	testErr         error
+	drifted         []appv1.HelmAppDriftedResource
+	missing         []appv1.HelmAppDriftedResource
+	upgrades        int
+	rollbacks       int
+	replaceErr      error
+	replaces        int
+	upgradeRequired bool
+	valuesDigest    string
+}
+
+func (m *fakeReleaseManager) IsInstalled() bool {
+	return true
+}
+
+func (m *fakeReleaseManager) IsUpgradeRequired() bool {
+	return m.upgradeRequired
+}
+
+func (m *fakeReleaseManager) ValuesDigest() string {
+	return m.valuesDigest
+}
+
+func (m *fakeReleaseManager) GetDeployedRelease() (*rspb.Release, error) {
+	return &rspb.Release{Name: "example", Version: 1}, nil
+}
+
+func (m *fakeReleaseManager) ReplaceCRDs(context.Context) error {
+	m.replaces++
+	return m.replaceErr
+}
+
+func (m *fakeReleaseManager) DetectDrift(_ context.Context, correct bool) ([]appv1.HelmAppDriftedResource, error) {
+	return m.drifted, nil
+}
+
+// CreateMissingResources returns the missing resources once, they exist after their creation
+func (m *fakeReleaseManager) CreateMissingResources(context.Context) ([]appv1.HelmAppDriftedResource, error) {
+	created := m.missing
+	m.missing = nil
+
+	return created, nil
+}
+
+func (m *fakeReleaseManager) UpgradeRelease(context.Context, ...helmoperator.UpgradeOption) (*rspb.Release, *rspb.Release, error) {
+	m.upgrades++
+
+	if m.upgradeErr != nil {
+		return nil, nil, m.upgradeErr
+	}
+
+	return nil, &rspb.Release{Name: "example"}, nil
+}
+
+func (m *fakeReleaseManager) TestRelease(context.Context, ...helmoperator.TestOption) (*rspb.Release, error) {
+	phase := rspb.HookPhaseSucceeded
+	if m.testErr != nil {
+		phase = rspb.HookPhaseFailed
+	}
+
+	return &rspb.Release{
+		Name: "example",
+		Hooks: []*rspb.Hook{
+			{
+				Name:    "example-test",
+				Events:  []rspb.HookEvent{rspb.HookTest},
+				LastRun: rspb.HookExecution{StartedAt: helmtime.Now(), Phase: phase},
+			},
+			{
+				Name:   "example-test-skipped",
+				Events: []rspb.HookEvent{rspb.HookTest},
+			},
+			{
+				Name:   "example-post-install",
+				Events: []rspb.HookEvent{rspb.HookPostInstall},
+			},
+		},
+	}, m.testErr
+}
+
+func (m *fakeReleaseManager) RollbackRelease(context.Context, ...helmoperator.RollbackOption) error {
+	m.rollbacks++
+	return nil
+}
+
+func (m *fakeReleaseManager) UninstallRelease(context.Context, ...helmoperator.UninstallOption) (*rspb.Release, error) {
+	return nil, nil
+}
+
+func (m *fakeReleaseManager) GetActionConfig() *action.Configuration {
+	return nil
+}
+
+// fakeManager is a controller manager only providing a client
+type fakeManager struct {
+	manager.Manager
+	client client.Client
+}
+
+func (m fakeManager) GetClient() client.Client {
+	return m.client
+}
+
+func TestUpgradeRemediation(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	instance := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "example-remediation",
+			Namespace: helmReleaseNS,
+		},
+		Remediation: &appv1.Remediation{Retries: 1},
+	}
+
+	rec := &ReconcileHelmRelease{Manager: fakeManager{client: fake.NewFakeClientWithScheme(scheme.Scheme, instance.DeepCopy())}}
+	releaseManager := &fakeReleaseManager{upgradeErr: fmt.Errorf("upgrade failed")}
+
+	result, err := rec.upgrade(instance, releaseManager)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result).To(gomega.Equal(reconcile.Result{RequeueAfter: time.Minute}))
+	g.Expect(instance.Status.UpgradeFailures).To(gomega.Equal(1))
+	g.Expect(instance.Status.Attempts).To(gomega.Equal(1))
+	g.Expect(releaseManager.rollbacks).To(gomega.Equal(0))
+
+	result, err = rec.upgrade(instance, releaseManager)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result).To(gomega.Equal(reconcile.Result{}))
+	g.Expect(instance.Status.UpgradeFailures).To(gomega.Equal(2))
+	g.Expect(instance.Status.Attempts).To(gomega.Equal(0))
+	g.Expect(releaseManager.rollbacks).To(gomega.Equal(1))
+
+	condition := instance.Status.Conditions[0]
+	g.Expect(condition.Type).To(gomega.Equal(appv1.ConditionReleaseFailed))
+	g.Expect(condition.Reason).To(gomega.Equal(appv1.ReasonRollbackSuccessful))
+
+	instance.Remediation = nil
+
+	_, err = rec.upgrade(instance, releaseManager)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(releaseManager.rollbacks).To(gomega.Equal(1))
+
+	// the rolled back HelmRelease keeps polling its source
+	instance.Remediation = &appv1.Remediation{Retries: 0}
+	instance.Repo.Source = &appv1.Source{
+		SourceType: appv1.GitSourceType,
+		Git:        &appv1.Git{Urls: []string{"https://git.example.com/charts.git"}, PollInterval: &metav1.Duration{Duration: time.Minute * 5}},
+	}
+
+	result, err = rec.upgrade(instance, releaseManager)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(releaseManager.rollbacks).To(gomega.Equal(2))
+	g.Expect(result).To(gomega.Equal(reconcile.Result{RequeueAfter: time.Minute * 5}))
+}
+
+func TestRolledBackUpgrade(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	instance := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "example-rolled-back",
+			Namespace:  helmReleaseNS,
+			Generation: 1,
+			Finalizers: []string{finalizer},
+		},
+		Repo:        appv1.HelmReleaseRepo{Version: "1.0.0"},
+		Remediation: &appv1.Remediation{Retries: 0},
+	}
+
+	rec := &ReconcileHelmRelease{Manager: fakeManager{client: fake.NewFakeClientWithScheme(scheme.Scheme, instance.DeepCopy())}}
+	releaseManager := &fakeReleaseManager{
+		upgradeErr:      fmt.Errorf("upgrade failed"),
+		upgradeRequired: true,
+		valuesDigest:    "sha256:1",
+	}
+
+	_, err := rec.reconcileRelease(instance, releaseManager)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(releaseManager.upgrades).To(gomega.Equal(1))
+	g.Expect(releaseManager.rollbacks).To(gomega.Equal(1))
+	g.Expect(instance.Status.UpgradeFailures).To(gomega.Equal(1))
+	g.Expect(instance.Status.RolledBackTarget).To(gomega.Equal(&appv1.HelmAppUpgradeTarget{
+		Generation: 1, Revision: "1.0.0", ValuesDigest: "sha256:1",
+	}))
+
+	// the rolled back upgrade is not attempted again by the next reconcile
+	_, err = rec.reconcileRelease(instance, releaseManager)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(releaseManager.upgrades).To(gomega.Equal(1))
+	g.Expect(instance.Status.UpgradeFailures).To(gomega.Equal(1))
+	g.Expect(instance.Status.LastAppliedRevision).To(gomega.BeEmpty())
+
+	rolledBack := false
+
+	for _, condition := range instance.Status.Conditions {
+		if condition.Type == appv1.ConditionReleaseFailed {
+			rolledBack = condition.Reason == appv1.ReasonRollbackSuccessful
+		}
+	}
+
+	g.Expect(rolledBack).To(gomega.BeTrue())
+
+	// a change of the values resets the failures and upgrades again
+	releaseManager.valuesDigest = "sha256:2"
+	releaseManager.upgradeErr = nil
+
+	_, err = rec.reconcileRelease(instance, releaseManager)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(releaseManager.upgrades).To(gomega.Equal(2))
+	g.Expect(instance.Status.UpgradeFailures).To(gomega.Equal(0))
+	g.Expect(instance.Status.RolledBackTarget).To(gomega.BeNil())
+}
+
+func TestUninstallRemovesReleaseCharts(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	chartsDir, err := ioutil.TempDir("/tmp", "charts")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	defer os.RemoveAll(chartsDir)
+
+	defer func(dir string) { ChartsDir = dir }(ChartsDir)
+	ChartsDir = chartsDir
+
+	instance := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "example-uninstall",
+			Namespace:  helmReleaseNS,
+			Finalizers: []string{finalizer},
+		},
+	}
+
+	releaseDir := utils.ReleaseChartsDir(chartsDir, instance)
+	g.Expect(os.MkdirAll(filepath.Join(releaseDir, "chart"), 0750)).To(gomega.Succeed())
+
+	cacheDir := filepath.Join(chartsDir, utils.ChartCacheDirName)
+	g.Expect(os.MkdirAll(cacheDir, 0750)).To(gomega.Succeed())
+
+	rec := &ReconcileHelmRelease{Manager: fakeManager{client: fake.NewFakeClientWithScheme(scheme.Scheme, instance.DeepCopy())}}
+
+	_, err = rec.uninstall(instance, &fakeReleaseManager{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(instance.GetFinalizers()).To(gomega.BeEmpty())
+
+	_, err = os.Stat(filepath.Dir(releaseDir))
+	g.Expect(os.IsNotExist(err)).To(gomega.BeTrue())
+
+	// the chart cache is kept for the other HelmReleases
+	_, err = os.Stat(cacheDir)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+}
+
+func TestChartsDir(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	defer func(dir string) { ChartsDir = dir }(ChartsDir)
+	ChartsDir = ""
+
+	// the temporary charts directory is created once and shared by the reconciles
+	dir, err := chartsDir()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	defer os.RemoveAll(dir)
+
+	g.Expect(ChartsDir).To(gomega.Equal(dir))
+	g.Expect(chartsDir()).To(gomega.Equal(dir))
+
+	instance := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "example-charts-dir",
+			Namespace: helmReleaseNS,
+		},
+	}
+
+	releaseDir := utils.ReleaseChartsDir(dir, instance)
+	g.Expect(os.MkdirAll(releaseDir, 0750)).To(gomega.Succeed())
+
+	removeReleaseCharts(instance)
+
+	_, err = os.Stat(releaseDir)
+	g.Expect(os.IsNotExist(err)).To(gomega.BeTrue())
+}
+
+func TestWaitSettings(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	instance := &appv1.HelmRelease{}
+
+	wait, waitForJobs, timeout := waitSettings(instance)
+	g.Expect(wait).To(gomega.BeFalse())
+	g.Expect(waitForJobs).To(gomega.BeFalse())
+	g.Expect(timeout).To(gomega.BeZero())
+
+	setReadyCondition(instance, nil)
+	g.Expect(instance.Status.Conditions).To(gomega.BeEmpty())
+
+	instance.WaitForJobs = true
+
+	wait, waitForJobs, timeout = waitSettings(instance)
+	g.Expect(wait).To(gomega.BeTrue())
+	g.Expect(waitForJobs).To(gomega.BeTrue())
+	g.Expect(timeout).To(gomega.Equal(defaultWaitTimeout))
+
+	instance.Timeout = &metav1.Duration{Duration: time.Minute}
+
+	_, _, timeout = waitSettings(instance)
+	g.Expect(timeout).To(gomega.Equal(time.Minute))
+
+	setReadyCondition(instance, fmt.Errorf("timed out waiting for the condition"))
+	g.Expect(instance.Status.Conditions).To(gomega.HaveLen(1))
+	g.Expect(instance.Status.Conditions[0].Status).To(gomega.Equal(appv1.StatusFalse))
+	g.Expect(instance.Status.Conditions[0].Reason).To(gomega.Equal(appv1.ReasonReleaseNotReady))
+
+	setReadyCondition(instance, nil)
+	g.Expect(instance.Status.Conditions[0].Type).To(gomega.Equal(appv1.ConditionReady))
+	g.Expect(instance.Status.Conditions[0].Status).To(gomega.Equal(appv1.StatusTrue))
+}
+
+func TestCRDPolicy(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	mch := &unstructured.Unstructured{}
+	mch.SetAPIVersion("apps.open-cluster-management.io/v1")
+	mch.SetKind("Subscription")
+	mch.SetNamespace(helmReleaseNS)
+	mch.SetName("example-sub")
+	mch.SetOwnerReferences([]metav1.OwnerReference{
+		{APIVersion: "operator.open-cluster-management.io/v1", Kind: "MultiClusterHub", Name: "multiclusterhub"},
+	})
+
+	instance := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "example-crds",
+			Namespace: helmReleaseNS,
+		},
+	}
+
+	rec := &ReconcileHelmRelease{Manager: fakeManager{client: fake.NewFakeClientWithScheme(scheme.Scheme,
+		instance.DeepCopy(), mch)}}
+
+	policy, err := rec.crdPolicy(instance)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(policy).To(gomega.Equal(appv1.CRDPolicyCreate))
+
+	// the HelmReleases of a MultiClusterHub keep their CRDs on uninstall unless they set a policy
+	instance.SetOwnerReferences([]metav1.OwnerReference{
+		{APIVersion: "apps.open-cluster-management.io/v1", Kind: "Subscription", Name: "example-sub"},
+	})
+
+	policy, err = rec.crdPolicy(instance)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(policy).To(gomega.Equal(appv1.CRDPolicyKeepOnUninstall))
+
+	instance.CRDPolicy = appv1.CRDPolicySkip
+
+	policy, err = rec.crdPolicy(instance)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(policy).To(gomega.Equal(appv1.CRDPolicySkip))
+	g.Expect(rec.keepCRDsOnUninstall(instance, nil)).To(gomega.Succeed())
+
+	// the CRDs are only replaced with the CreateReplace policy
+	releaseManager := &fakeReleaseManager{}
+
+	_, err = rec.upgrade(instance, releaseManager)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(releaseManager.replaces).To(gomega.Equal(0))
+
+	instance.CRDPolicy = appv1.CRDPolicyCreateReplace
+
+	_, err = rec.upgrade(instance, releaseManager)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(releaseManager.replaces).To(gomega.Equal(1))
+
+	releaseManager.replaceErr = fmt.Errorf("crd replace failed")
+
+	_, err = rec.upgrade(instance, releaseManager)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(instance.Status.UpgradeFailures).To(gomega.Equal(1))
+
+	for _, condition := range instance.Status.Conditions {
+		if condition.Type == appv1.ConditionReleaseFailed {
+			g.Expect(condition.Reason).To(gomega.Equal(appv1.ReasonUpgradeError))
+			g.Expect(condition.Message).To(gomega.Equal("crd replace failed"))
+		}
+	}
+}
+
+func TestUpgradeTests(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	instance := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "example-tests",
+			Namespace: helmReleaseNS,
+		},
+		Test: &appv1.ReleaseTest{},
+	}
+
+	rec := &ReconcileHelmRelease{Manager: fakeManager{client: fake.NewFakeClientWithScheme(scheme.Scheme, instance.DeepCopy())}}
+	releaseManager := &fakeReleaseManager{}
+
+	_, err := rec.upgrade(instance, releaseManager)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(instance.Status.TestResults).To(gomega.Equal([]appv1.HelmAppTestResult{
+		{Name: "example-test", Phase: "Succeeded"},
+		{Name: "example-test-skipped", Phase: "Unknown"},
+	}))
+
+	condition := instance.Status.Conditions[0]
+	g.Expect(condition.Type).To(gomega.Equal(appv1.ConditionTestsPassed))
+	g.Expect(condition.Status).To(gomega.Equal(appv1.StatusTrue))
+
+	releaseManager.testErr = fmt.Errorf("pod example-test failed")
+
+	_, err = rec.upgrade(instance, releaseManager)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(instance.Status.TestResults[0].Phase).To(gomega.Equal("Failed"))
+	g.Expect(instance.Status.Conditions[0].Status).To(gomega.Equal(appv1.StatusFalse))
+	g.Expect(releaseManager.rollbacks).To(gomega.Equal(0))
+
+	instance.Test.Rollback = true
+
+	_, err = rec.upgrade(instance, releaseManager)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(releaseManager.rollbacks).To(gomega.Equal(1))
+
+	for _, condition := range instance.Status.Conditions {
+		if condition.Type == appv1.ConditionReleaseFailed {
+			g.Expect(condition.Reason).To(gomega.Equal(appv1.ReasonRollbackSuccessful))
+		}
+	}
+}
+
+func TestDetectDrift(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	instance := &appv1.HelmRelease{
+		DriftDetection: &appv1.DriftDetection{},
+	}
+
+	releaseManager := &fakeReleaseManager{}
+	recorder := record.NewFakeRecorder(10)
+	rec := &ReconcileHelmRelease{events: newEventRecorder(recorder)}
+
+	rec.detectDrift(instance, releaseManager)
+	g.Expect(instance.Status.DriftedResources).To(gomega.BeEmpty())
+	g.Expect(instance.Status.Conditions[0].Reason).To(gomega.Equal(appv1.ReasonNoDrift))
+	g.Expect(resyncResult(instance)).To(gomega.Equal(reconcile.Result{RequeueAfter: defaultDriftDetectionInterval}))
+
+	releaseManager.drifted = []appv1.HelmAppDriftedResource{
+		{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "default", Name: "example", Reason: "Modified"},
+	}
+
+	rec.detectDrift(instance, releaseManager)
+	g.Expect(instance.Status.DriftedResources).To(gomega.HaveLen(1))
+	g.Expect(instance.Status.Conditions[0].Status).To(gomega.Equal(appv1.StatusTrue))
+	g.Expect(instance.Status.Conditions[0].Reason).To(gomega.Equal(appv1.ReasonDriftDetected))
+	g.Expect(recorder.Events).To(gomega.Receive(gomega.Equal(
+		"Warning DriftDetected drifted 1 resources: Deployment default/example (Modified)")))
+
+	// the same drift is not reported again
+	rec.detectDrift(instance, releaseManager)
+	g.Expect(recorder.Events).NotTo(gomega.Receive())
+
+	instance.DriftDetection.Correct = true
+
+	rec.detectDrift(instance, releaseManager)
+	g.Expect(instance.Status.Conditions[0].Status).To(gomega.Equal(appv1.StatusFalse))
+	g.Expect(instance.Status.Conditions[0].Reason).To(gomega.Equal(appv1.ReasonDriftCorrected))
+	g.Expect(recorder.Events).To(gomega.Receive(gomega.HavePrefix("Normal DriftCorrected corrected 1 resources")))
+
+	instance.DriftDetection = nil
+
+	rec.detectDrift(instance, releaseManager)
+	g.Expect(instance.Status.DriftedResources).To(gomega.BeNil())
+	g.Expect(instance.Status.Conditions).To(gomega.BeEmpty())
+}
+
+func TestCreateMissingResources(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	instance := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "example-missing",
+			Namespace:  helmReleaseNS,
+			Finalizers: []string{finalizer},
+		},
+	}
+
+	deleted := []appv1.HelmAppDriftedResource{
+		{APIVersion: "apps/v1", Kind: "Deployment", Namespace: helmReleaseNS, Name: "example", Reason: "Missing"},
+	}
+
+	releaseManager := &fakeReleaseManager{missing: deleted}
+	recorder := record.NewFakeRecorder(10)
+	rec := &ReconcileHelmRelease{
+		Manager: fakeManager{client: fake.NewFakeClientWithScheme(scheme.Scheme, instance.DeepCopy())},
+		events:  newEventRecorder(recorder),
+	}
+
+	// the missing resources are not created when the release resources are not watched
+	rec.detectDrift(instance, releaseManager)
+	g.Expect(releaseManager.missing).To(gomega.Equal(deleted))
+
+	// the reconcile of the deletion of a watched resource re-creates it without drift detection
+	rec.watches = newDependentWatches(&fakeController{watches: map[string]handler.EventHandler{}},
+		meta.NewDefaultRESTMapper(nil), nil)
+
+	_, err := rec.reconcileRelease(instance, releaseManager)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(releaseManager.missing).To(gomega.BeEmpty())
+	g.Expect(instance.Status.DriftedResources).To(gomega.BeNil())
+	g.Expect(recorder.Events).To(gomega.Receive(gomega.Equal(
+		"Normal DriftCorrected created 1 resources: Deployment " + helmReleaseNS + "/example (Missing)")))
+}
+
+// fakeController records the kinds and the handlers of the watches
+type fakeController struct {
+	controller.Controller
+	watches map[string]handler.EventHandler
+}
+
+func (c *fakeController) Watch(src source.Source, eventHandler handler.EventHandler, _ ...predicate.Predicate) error {
+	kind := src.(*source.Kind).Type.GetObjectKind().GroupVersionKind().Kind
+	c.watches[kind] = eventHandler
+
+	return nil
+}
+
+func TestWatchRelease(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(appv1.SchemeGroupVersion.WithKind("HelmRelease"), meta.RESTScopeNamespace)
+	restMapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	restMapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"},
+		meta.RESTScopeRoot)
+
+	c := &fakeController{watches: map[string]handler.EventHandler{}}
+	watches := newDependentWatches(c, restMapper, nil)
+
+	instance := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "example-watches",
+			Namespace: helmReleaseNS,
+		},
+	}
+
+	manifest := `---
+# Source: example/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: example
+---
+# Source: example/templates/clusterrole.yaml
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: example
+`
+
+	g.Expect(watches.watchRelease(instance, manifest)).To(gomega.Succeed())
+	g.Expect(c.watches).To(gomega.HaveLen(2))
+	g.Expect(c.watches["Deployment"]).To(gomega.BeAssignableToTypeOf(&handler.EnqueueRequestForOwner{}))
+	g.Expect(c.watches["ClusterRole"]).To(gomega.BeAssignableToTypeOf(&libhandler.EnqueueRequestForAnnotation{}))
+
+	// the kinds are watched once
+	c.watches = map[string]handler.EventHandler{}
+
+	g.Expect(watches.watchRelease(instance, manifest)).To(gomega.Succeed())
+	g.Expect(c.watches).To(gomega.BeEmpty())
+
+	// the cluster scoped kinds are not watched by the operator restricted to namespaces
+	c.watches = map[string]handler.EventHandler{}
+	watches = newDependentWatches(c, restMapper, []string{helmReleaseNS})
+
+	g.Expect(watches.watchRelease(instance, manifest)).To(gomega.Succeed())
+	g.Expect(c.watches).To(gomega.HaveLen(1))
+	g.Expect(c.watches).To(gomega.HaveKey("Deployment"))
+}
+
+func TestReleaseMetrics(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	deployed := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-deployed", Namespace: helmReleaseNS},
+		Status: appv1.HelmAppStatus{Conditions: []appv1.HelmAppCondition{
+			{Type: appv1.ConditionDeployed, Status: appv1.StatusTrue},
+			{Type: appv1.ConditionReady, Status: appv1.StatusTrue},
+		}},
+	}
+	failed := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-failed", Namespace: helmReleaseNS},
+		Status: appv1.HelmAppStatus{Conditions: []appv1.HelmAppCondition{
+			{Type: appv1.ConditionDeployed, Status: appv1.StatusTrue},
+			{Type: appv1.ConditionReleaseFailed, Status: appv1.StatusTrue},
+			{Type: appv1.ConditionReady, Status: appv1.StatusFalse},
+		}},
+	}
+
+	collector := &releasesCollector{client: fake.NewFakeClientWithScheme(scheme.Scheme, deployed, failed)}
+
+	g.Expect(testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP helmrelease_releases Number of HelmReleases with a condition of the type set to True
+# TYPE helmrelease_releases gauge
+helmrelease_releases{condition="Deployed"} 2
+helmrelease_releases{condition="Irreconcilable"} 0
+helmrelease_releases{condition="Ready"} 1
+helmrelease_releases{condition="ReleaseFailed"} 1
+`))).To(gomega.Succeed())
+
+	series := testutil.CollectAndCount(releaseOperations)
+
+	observeOperation(failed, operationUpgrade, time.Now(), fmt.Errorf("upgrade failed"))
+	g.Expect(testutil.ToFloat64(releaseOperations.WithLabelValues(helmReleaseNS, "example-failed", operationUpgrade,
+		resultFailure))).To(gomega.Equal(float64(1)))
+
+	deleteOperationMetrics(helmReleaseNS, "example-failed")
+	g.Expect(testutil.CollectAndCount(releaseOperations)).To(gomega.Equal(series))
+}
+
+func TestEventRecorder(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	instance := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-events", Namespace: helmReleaseNS},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	events := newEventRecorder(recorder)
+
+	events.event(instance, corev1.EventTypeWarning, string(appv1.ReasonInstallError), "install failed")
+	events.event(instance, corev1.EventTypeNormal, eventReasonChartDownloaded, "downloaded chart nginx")
+	events.event(instance, corev1.EventTypeWarning, string(appv1.ReasonInstallError), "install failed")
+	g.Expect(recorder.Events).To(gomega.HaveLen(2))
+
+	events.event(instance, corev1.EventTypeWarning, string(appv1.ReasonInstallError), "install timed out")
+	g.Expect(recorder.Events).To(gomega.HaveLen(3))
+
+	events.forget(instance.GetNamespace(), instance.GetName())
+	events.event(instance, corev1.EventTypeWarning, string(appv1.ReasonInstallError), "install timed out")
+	g.Expect(recorder.Events).To(gomega.HaveLen(4))
+
+	// the reconcilers without recorder emit no event
+	(&ReconcileHelmRelease{}).events.event(instance, corev1.EventTypeNormal, eventReasonFinalizerRemoved, "")
+}
+
+func TestValidationErrorEvent(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	instance := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-invalid", Namespace: helmReleaseNS},
+		Repo: appv1.HelmReleaseRepo{
+			Source: &appv1.Source{
+				SourceType: appv1.HelmRepoSourceType,
+				HelmRepo:   &appv1.HelmRepo{Urls: []string{"https://charts.example.com"}},
+			},
+			ChartName: "nginx",
+			Digest:    "invalid",
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	rec := &ReconcileHelmRelease{
+		Manager: fakeManager{client: fake.NewFakeClientWithScheme(scheme.Scheme, instance)},
+		events:  newEventRecorder(recorder),
+	}
+
+	result, err := rec.Reconcile(reconcile.Request{
+		NamespacedName: types.NamespacedName{Namespace: helmReleaseNS, Name: "example-invalid"},
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result).To(gomega.Equal(reconcile.Result{}))
+	g.Expect(recorder.Events).To(gomega.HaveLen(1))
+	g.Expect(<-recorder.Events).To(gomega.HavePrefix("Warning " + string(appv1.ReasonValidationError) + " "))
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helmrelease
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+)
+
+const (
+	// eventDedupPeriod is how long an event of a HelmRelease is not emitted again with the same reason and message
+	eventDedupPeriod = time.Hour
+
+	// the events without matching condition reason
+	eventReasonChartDownloaded  = "ChartDownloaded"
+	eventReasonFinalizerRemoved = "FinalizerRemoved"
+)
+
+// eventRecorder emits the events of the HelmReleases. The events repeated by the retries of a failing
+// reconcile are dropped during the dedup period.
+type eventRecorder struct {
+	recorder record.EventRecorder
+
+	mutex sync.Mutex
+	// last are the last emitted events of each HelmRelease by reason
+	last map[types.NamespacedName]map[string]emittedEvent
+}
+
+type emittedEvent struct {
+	eventType string
+	message   string
+	time      time.Time
+}
+
+func newEventRecorder(recorder record.EventRecorder) *eventRecorder {
+	return &eventRecorder{
+		recorder: recorder,
+		last:     map[types.NamespacedName]map[string]emittedEvent{},
+	}
+}
+
+// event emits an event of the HelmRelease unless the same event was emitted during the dedup period,
+// it does nothing on a nil recorder
+func (e *eventRecorder) event(hr *appv1.HelmRelease, eventType, reason, message string) {
+	if e == nil {
+		return
+	}
+
+	key := types.NamespacedName{Namespace: hr.GetNamespace(), Name: hr.GetName()}
+	emitted := emittedEvent{eventType: eventType, message: message, time: time.Now()}
+
+	e.mutex.Lock()
+
+	if e.last[key] == nil {
+		e.last[key] = map[string]emittedEvent{}
+	}
+
+	last, ok := e.last[key][reason]
+	duplicate := ok && last.eventType == eventType && last.message == message &&
+		emitted.time.Sub(last.time) < eventDedupPeriod
+
+	if !duplicate {
+		e.last[key][reason] = emitted
+	}
+
+	e.mutex.Unlock()
+
+	if duplicate {
+		return
+	}
+
+	e.recorder.Event(hr, eventType, reason, message)
+}
+
+// forget drops the emitted events of a deleted HelmRelease
+func (e *eventRecorder) forget(namespace, name string) {
+	if e == nil {
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	delete(e.last, types.NamespacedName{Namespace: namespace, Name: name})
+}
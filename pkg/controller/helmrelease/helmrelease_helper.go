@@ -35,8 +35,8 @@ import (
 	"helm.sh/helm/v3/pkg/chartutil"
 	rspb "helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/releaseutil"
-	"helm.sh/helm/v3/pkg/storage"
-	"helm.sh/helm/v3/pkg/storage/driver"
+
+	helmoperator "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/release"
 )
 
 // nameFilter filters a set of Helm storage releases by name.
@@ -95,29 +95,52 @@ func (r *ReconcileHelmRelease) isMultiClusterHubOwnedResource(hr *appv1.HelmRele
 	return false, nil
 }
 
-// Remove CRD references from Helm storage and HelmRelease's Status.DeployedRelease.Manifest
-// TODO add an annotation to trigger this feature instead of triggering on MultiClusterHub owned resource
-func (r *ReconcileHelmRelease) hackMultiClusterHubRemoveCRDReferences(hr *appv1.HelmRelease, c *action.Configuration) error {
-	klog.V(3).Info("Running hackMultiClusterHubRemoveCRDReferences on ", hr.GetNamespace(), "/", hr.GetName())
+// crdPolicy returns the CRD policy of the HelmRelease, the HelmReleases owned by a MultiClusterHub keep their
+// CRDs on uninstall when they do not set one
+func (r *ReconcileHelmRelease) crdPolicy(hr *appv1.HelmRelease) (appv1.CRDPolicy, error) {
+	if hr.CRDPolicy != "" {
+		return hr.CRDPolicy, nil
+	}
 
 	isOwnedByMCH, err := r.isMultiClusterHubOwnedResource(hr)
 	if err != nil {
 		klog.Error("Failed to determine if HelmRelease is owned a MultiClusterHub resource: ",
 			hr.GetNamespace(), "/", hr.GetName())
 
+		return "", err
+	}
+
+	if isOwnedByMCH {
+		return appv1.CRDPolicyKeepOnUninstall, nil
+	}
+
+	return appv1.CRDPolicyCreate, nil
+}
+
+// keepCRDsOnUninstall removes the CRD references when the CRD policy of the HelmRelease is KeepOnUninstall
+func (r *ReconcileHelmRelease) keepCRDsOnUninstall(hr *appv1.HelmRelease, c *action.Configuration) error {
+	policy, err := r.crdPolicy(hr)
+	if err != nil {
 		return err
 	}
 
-	if !isOwnedByMCH {
-		klog.Info("HelmRelease is not owned by a MultiClusterHub resource: ",
-			hr.GetNamespace(), "/", hr.GetName())
+	if policy != appv1.CRDPolicyKeepOnUninstall {
+		klog.V(3).Info("HelmRelease does not keep its CRDs on uninstall: ", hr.GetNamespace(), "/", hr.GetName())
 
 		return nil
 	}
 
-	klog.Info("HelmRelease is owned by a MultiClusterHub resource proceed with the removal of all CRD references: ",
+	klog.Info("HelmRelease keeps its CRDs on uninstall proceed with the removal of all CRD references: ",
 		hr.GetNamespace(), "/", hr.GetName())
 
+	return r.removeCRDReferences(hr, c)
+}
+
+// Remove CRD references from Helm storage and HelmRelease's Status.DeployedRelease manifest and inventory so helm
+// does not delete the CRDs
+func (r *ReconcileHelmRelease) removeCRDReferences(hr *appv1.HelmRelease, c *action.Configuration) error {
+	klog.V(3).Info("Running removeCRDReferences on ", hr.GetNamespace(), "/", hr.GetName())
+
 	clientv1, err := v1.NewForConfig(r.GetConfig())
 	if err != nil {
 		klog.Error("Failed create client for HelmRelease: ", hr.GetNamespace(), "/", hr.GetName())
@@ -125,7 +148,7 @@ func (r *ReconcileHelmRelease) hackMultiClusterHubRemoveCRDReferences(hr *appv1.
 		return err
 	}
 
-	storageBackend := storage.Init(driver.NewSecrets(clientv1.Secrets(hr.GetNamespace())))
+	storageBackend := helmoperator.NewStorage(clientv1.Secrets(hr.GetNamespace()), hr.GetUID())
 
 	storageReleases, err := storageBackend.List(
 		func(rls *rspb.Release) bool {
@@ -145,6 +168,9 @@ func (r *ReconcileHelmRelease) hackMultiClusterHubRemoveCRDReferences(hr *appv1.
 			hr.GetNamespace(), "/", hr.GetName())
 	}
 
+	// the digest of the deployed release follows the stripped manifest of its storage release
+	deployedDigest := ""
+
 	for _, storageRelease := range storageReleases {
 		klog.Info("Release: ", storageRelease.Name)
 
@@ -161,6 +187,10 @@ func (r *ReconcileHelmRelease) hackMultiClusterHubRemoveCRDReferences(hr *appv1.
 
 			storageRelease.Manifest = newManifest
 
+			if hr.Status.DeployedRelease != nil && hr.Status.DeployedRelease.Revision == storageRelease.Version {
+				deployedDigest = manifestDigest(newManifest)
+			}
+
 			err = storageBackend.Update(storageRelease)
 			if err != nil {
 				klog.Error("Failed update storage release for HelmRelease: ", hr.GetNamespace(), "/", hr.GetName())
@@ -183,18 +213,36 @@ func (r *ReconcileHelmRelease) hackMultiClusterHubRemoveCRDReferences(hr *appv1.
 	klog.Info("HelmRelease contains Status.DeployedRelease, attempting to strip CRDs from it: ",
 		hr.GetNamespace(), "/", hr.GetName())
 
-	newManifest, changed, err := stripCRDs(hr.Status.DeployedRelease.Manifest, c)
-	if err != nil {
-		return err
+	changed := false
+
+	if hr.Status.DeployedRelease.Manifest != "" {
+		newManifest, manifestChanged, err := stripCRDs(hr.Status.DeployedRelease.Manifest, c)
+		if err != nil {
+			return err
+		}
+
+		if manifestChanged {
+			hr.Status.DeployedRelease.Manifest = newManifest
+			changed = true
+		}
+	}
+
+	if inventory, inventoryChanged := stripInventoryCRDs(hr.Status.DeployedRelease.Inventory); inventoryChanged {
+		hr.Status.DeployedRelease.Inventory = inventory
+		changed = true
 	}
+
+	if deployedDigest != "" && deployedDigest != hr.Status.DeployedRelease.ManifestDigest {
+		hr.Status.DeployedRelease.ManifestDigest = deployedDigest
+		changed = true
+	}
+
 	if changed {
 		klog.Info("Status release: ", hr.GetName(), " needs updating")
 
-		hr.Status.DeployedRelease.Manifest = newManifest
-
 		err = r.updateResourceStatus(hr)
 		if err != nil {
-			klog.Error("Failed to update Status.DeployedRelease.Manifest for HelmRelease: ",
+			klog.Error("Failed to update Status.DeployedRelease for HelmRelease: ",
 				hr.GetNamespace(), "/", hr.GetName())
 
 			return err
@@ -0,0 +1,142 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helmrelease
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+)
+
+// manifestDigest returns the sha256 digest of a release manifest
+func manifestDigest(manifest string) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(manifest)))
+}
+
+// releaseInventory lists the resources of a release manifest. The namespaced resources without a namespace are
+// deployed in the namespace of the release, they are only resolved when a restMapper is given.
+func releaseInventory(manifest, namespace string, restMapper meta.RESTMapper) ([]appv1.HelmAppResource, error) {
+	inventory := []appv1.HelmAppResource{}
+
+	manifests := releaseutil.SplitManifests(manifest)
+
+	// the inventory follows the order of the manifest
+	keys := make([]string, 0, len(manifests))
+	for key := range manifests {
+		keys = append(keys, key)
+	}
+
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	for _, key := range keys {
+		content := manifests[key]
+
+		resource := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(content), resource); err != nil {
+			return nil, fmt.Errorf("failed to parse the release manifest: %w", err)
+		}
+
+		gvk := resource.GroupVersionKind()
+		if gvk.Kind == "" {
+			continue
+		}
+
+		resourceNamespace := resource.GetNamespace()
+
+		if resourceNamespace == "" && restMapper != nil {
+			mapping, err := restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+			if err != nil {
+				klog.V(3).Info("Failed to get the scope of ", gvk, " for the inventory: ", err)
+			} else if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+				resourceNamespace = namespace
+			}
+		}
+
+		inventory = append(inventory, appv1.HelmAppResource{
+			APIVersion:     resource.GetAPIVersion(),
+			Kind:           resource.GetKind(),
+			Namespace:      resourceNamespace,
+			Name:           resource.GetName(),
+			ResourcePolicy: resource.GetAnnotations()[kube.ResourcePolicyAnno],
+		})
+	}
+
+	return inventory, nil
+}
+
+// inventoryManifest renders the resources of an inventory as a manifest holding only their identity and
+// resource policy
+func inventoryManifest(inventory []appv1.HelmAppResource) (string, error) {
+	var builder strings.Builder
+
+	for _, item := range inventory {
+		resource := &unstructured.Unstructured{}
+		resource.SetAPIVersion(item.APIVersion)
+		resource.SetKind(item.Kind)
+		resource.SetNamespace(item.Namespace)
+		resource.SetName(item.Name)
+
+		if item.ResourcePolicy != "" {
+			resource.SetAnnotations(map[string]string{kube.ResourcePolicyAnno: item.ResourcePolicy})
+		}
+
+		content, err := yaml.Marshal(resource.Object)
+		if err != nil {
+			return "", fmt.Errorf("failed to render the release inventory: %w", err)
+		}
+
+		builder.WriteString("\n---\n" + string(content))
+	}
+
+	return builder.String(), nil
+}
+
+// releaseManifest returns the manifest of the deployed release, it is rendered from the inventory when the
+// manifest is not stored in the status
+func releaseManifest(deployed *appv1.HelmAppRelease) (string, error) {
+	if deployed.Manifest != "" {
+		return deployed.Manifest, nil
+	}
+
+	return inventoryManifest(deployed.Inventory)
+}
+
+// stripInventoryCRDs removes the CustomResourceDefinitions from an inventory
+func stripInventoryCRDs(inventory []appv1.HelmAppResource) ([]appv1.HelmAppResource, bool) {
+	stripped := []appv1.HelmAppResource{}
+
+	for _, item := range inventory {
+		if item.Kind == "CustomResourceDefinition" {
+			klog.Info("CRD detected in the inventory: ", item.Name)
+			continue
+		}
+
+		stripped = append(stripped, item)
+	}
+
+	return stripped, len(stripped) != len(inventory)
+}
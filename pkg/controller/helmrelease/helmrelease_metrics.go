@@ -0,0 +1,130 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helmrelease
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+)
+
+const (
+	operationInstall   = "install"
+	operationUpgrade   = "upgrade"
+	operationRollback  = "rollback"
+	operationUninstall = "uninstall"
+
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+var (
+	operations = []string{operationInstall, operationUpgrade, operationRollback, operationUninstall}
+
+	// releaseConditions are always reported by the releases gauge, the other condition types only when a
+	// HelmRelease has them
+	releaseConditions = []appv1.HelmAppConditionType{appv1.ConditionDeployed, appv1.ConditionReleaseFailed,
+		appv1.ConditionIrreconcilable}
+
+	releaseOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "helmrelease_operations_total",
+		Help: "Number of helm install, upgrade, rollback and uninstall operations of a HelmRelease by result",
+	}, []string{"namespace", "name", "operation", "result"})
+	releaseOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "helmrelease_operation_duration_seconds",
+		Help:    "Duration of the helm install, upgrade, rollback and uninstall operations of a HelmRelease",
+		Buckets: []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"namespace", "name", "operation", "result"})
+	releasesDesc = prometheus.NewDesc("helmrelease_releases",
+		"Number of HelmReleases with a condition of the type set to True", []string{"condition"}, nil)
+)
+
+func init() {
+	metrics.Registry.MustRegister(releaseOperations, releaseOperationDuration)
+}
+
+// observeOperation records the result and the duration of a helm operation of the HelmRelease
+func observeOperation(hr *appv1.HelmRelease, operation string, started time.Time, err error) {
+	result := resultSuccess
+	if err != nil {
+		result = resultFailure
+	}
+
+	labels := prometheus.Labels{"namespace": hr.GetNamespace(), "name": hr.GetName(), "operation": operation,
+		"result": result}
+
+	releaseOperations.With(labels).Inc()
+	releaseOperationDuration.With(labels).Observe(time.Since(started).Seconds())
+}
+
+// deleteOperationMetrics removes the series of a deleted HelmRelease
+func deleteOperationMetrics(namespace, name string) {
+	for _, operation := range operations {
+		for _, result := range []string{resultSuccess, resultFailure} {
+			labels := prometheus.Labels{"namespace": namespace, "name": name, "operation": operation, "result": result}
+
+			releaseOperations.Delete(labels)
+			releaseOperationDuration.Delete(labels)
+		}
+	}
+}
+
+// releasesCollector counts the HelmReleases of the cache by condition when the metrics are scraped
+type releasesCollector struct {
+	client client.Client
+}
+
+// blank assignment to verify that releasesCollector implements prometheus.Collector
+var _ prometheus.Collector = &releasesCollector{}
+
+// Describe implements prometheus.Collector
+func (c *releasesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- releasesDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *releasesCollector) Collect(ch chan<- prometheus.Metric) {
+	hrList := &appv1.HelmReleaseList{}
+
+	if err := c.client.List(context.TODO(), hrList); err != nil {
+		klog.Error("Failed to list the HelmReleases for the metrics: ", err)
+		return
+	}
+
+	counts := map[appv1.HelmAppConditionType]int{}
+	for _, condition := range releaseConditions {
+		counts[condition] = 0
+	}
+
+	for _, hr := range hrList.Items {
+		for _, condition := range hr.Status.Conditions {
+			if condition.Status == appv1.StatusTrue {
+				counts[condition.Type]++
+			}
+		}
+	}
+
+	for condition, count := range counts {
+		ch <- prometheus.MustNewConstMetric(releasesDesc, prometheus.GaugeValue, float64(count), string(condition))
+	}
+}
@@ -0,0 +1,306 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helmrelease
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+	helmoperator "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/release"
+)
+
+// OverrideValues are the operator wide key.path=value overrides, they are applied to the values of
+// every HelmRelease after its own overrideValues
+var OverrideValues map[string]string
+
+// valuesFromIndexField indexes the HelmReleases by the ConfigMaps and Secrets of their valuesFrom
+const valuesFromIndexField = "valuesFrom"
+
+// valuesFromIndexKey returns the valuesFrom index key of a values object
+func valuesFromIndexKey(kind appv1.ValuesReferenceKind, name string) string {
+	return string(kind) + "/" + name
+}
+
+// indexValuesFrom returns the valuesFrom index keys of a HelmRelease
+func indexValuesFrom(obj runtime.Object) []string {
+	hr, ok := obj.(*appv1.HelmRelease)
+	if !ok {
+		return nil
+	}
+
+	keys := []string{}
+	for _, ref := range hr.ValuesFrom {
+		keys = append(keys, valuesFromIndexKey(ref.Kind, ref.Name))
+	}
+
+	return keys
+}
+
+// addValuesFromWatches enqueues the HelmReleases referencing a ConfigMap or a Secret in their valuesFrom
+// when it changes. Only the metadata of the ConfigMaps and Secrets is watched and cached, their data is read
+// from the API server when the values are resolved.
+func addValuesFromWatches(mgr manager.Manager, c controller.Controller) error {
+	err := mgr.GetFieldIndexer().IndexField(context.TODO(), &appv1.HelmRelease{}, valuesFromIndexField, indexValuesFrom)
+	if err != nil {
+		return err
+	}
+
+	metadataClient, err := metadata.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+
+	factories := valuesFromInformerFactories(metadataClient, WatchNamespaces)
+
+	for _, factory := range factories {
+		for kind, gvr := range valuesFromResources {
+			if err := c.Watch(&source.Informer{Informer: factory.ForResource(gvr).Informer()},
+				&handler.EnqueueRequestsFromMapFunc{ToRequests: valuesFromMapper(mgr.GetClient(), kind)},
+				valuesFromPredicate(mgr.GetClient(), kind)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the informers are started with the manager
+	return mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+		for _, factory := range factories {
+			factory.Start(stop)
+			factory.WaitForCacheSync(stop)
+		}
+
+		<-stop
+
+		return nil
+	}))
+}
+
+// valuesFromResources are the resources of the values object kinds
+var valuesFromResources = map[appv1.ValuesReferenceKind]schema.GroupVersionResource{
+	appv1.ConfigMapValuesKind: corev1.SchemeGroupVersion.WithResource("configmaps"),
+	appv1.SecretValuesKind:    corev1.SchemeGroupVersion.WithResource("secrets"),
+}
+
+// valuesFromInformerFactories returns a metadata informer factory per namespace, or a single cluster wide factory
+// when no namespace is given, so the values objects are only listed in the namespaces of the manager cache
+func valuesFromInformerFactories(c metadata.Interface, namespaces []string) []metadatainformer.SharedInformerFactory {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	factories := []metadatainformer.SharedInformerFactory{}
+	for _, namespace := range namespaces {
+		factories = append(factories, metadatainformer.NewFilteredSharedInformerFactory(c, 0, namespace, nil))
+	}
+
+	return factories
+}
+
+// valuesFromPredicate filters the events of the values objects of the kind not referenced by a HelmRelease
+func valuesFromPredicate(c client.Client, kind appv1.ValuesReferenceKind) predicate.Predicate {
+	referenced := func(obj metav1.Object) bool {
+		return len(valuesFromReferences(c, kind, obj)) > 0
+	}
+
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return referenced(e.Meta)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			// the resyncs are ignored
+			return e.MetaOld.GetResourceVersion() != e.MetaNew.GetResourceVersion() && referenced(e.MetaNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return referenced(e.Meta)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return referenced(e.Meta)
+		},
+	}
+}
+
+// valuesFromMapper maps a values object of the kind to the HelmReleases of its namespace referencing it
+func valuesFromMapper(c client.Client, kind appv1.ValuesReferenceKind) handler.ToRequestsFunc {
+	return func(a handler.MapObject) []reconcile.Request {
+		requests := []reconcile.Request{}
+
+		for _, hr := range valuesFromReferences(c, kind, a.Meta) {
+			klog.V(3).Info("Values ", kind, " ", a.Meta.GetNamespace(), "/", a.Meta.GetName(),
+				" changed, reconciling ", helmreleaseNsn(hr))
+
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: hr.Namespace, Name: hr.Name},
+			})
+		}
+
+		return requests
+	}
+}
+
+// valuesFromReferences returns the HelmReleases of the namespace of the values object of the kind referencing it,
+// they are looked up through the valuesFrom index
+func valuesFromReferences(c client.Client, kind appv1.ValuesReferenceKind, obj metav1.Object) []*appv1.HelmRelease {
+	hrList := &appv1.HelmReleaseList{}
+
+	err := c.List(context.TODO(), hrList, client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{valuesFromIndexField: valuesFromIndexKey(kind, obj.GetName())})
+	if err != nil {
+		klog.Error(err, " - Failed to list the HelmReleases referencing ", kind, " ",
+			obj.GetNamespace(), "/", obj.GetName())
+
+		return nil
+	}
+
+	hrs := []*appv1.HelmRelease{}
+	for i := range hrList.Items {
+		hrs = append(hrs, &hrList.Items[i])
+	}
+
+	return hrs
+}
+
+// getValues merges the values of the valuesFrom references in order, then the spec values and the overrideValues
+func getValues(c client.Reader, s *appv1.HelmRelease, specValues map[string]interface{}) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+
+	for _, ref := range s.ValuesFrom {
+		refValues, err := getReferenceValues(c, s.Namespace, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		values = helmoperator.MergeMaps(values, refValues)
+	}
+
+	values = helmoperator.MergeMaps(values, specValues)
+
+	overrides, err := helmoperator.ParseOverrides(s.OverrideValues)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the overrideValues of %s: %w", helmreleaseNsn(s), err)
+	}
+
+	return helmoperator.MergeMaps(values, overrides), nil
+}
+
+// getReferenceValues returns the values of a valuesFrom reference, nil when an optional reference is missing
+func getReferenceValues(c client.Reader, namespace string, ref appv1.ValuesReference) (map[string]interface{}, error) {
+	key := ref.ValuesKey
+	if key == "" {
+		key = appv1.DefaultValuesKey
+	}
+
+	nsn := types.NamespacedName{Namespace: namespace, Name: ref.Name}
+
+	var (
+		data  []byte
+		found bool
+	)
+
+	switch ref.Kind {
+	case appv1.ConfigMapValuesKind:
+		configMap := &corev1.ConfigMap{}
+
+		err := c.Get(context.TODO(), nsn, configMap)
+		if err != nil && !(apierrors.IsNotFound(err) && ref.Optional) {
+			return nil, fmt.Errorf("failed to get values ConfigMap %s: %w", nsn, err)
+		}
+
+		var value string
+		if value, found = configMap.Data[key]; found {
+			data = []byte(value)
+		} else {
+			data, found = configMap.BinaryData[key]
+		}
+	case appv1.SecretValuesKind:
+		secret := &corev1.Secret{}
+
+		err := c.Get(context.TODO(), nsn, secret)
+		if err != nil && !(apierrors.IsNotFound(err) && ref.Optional) {
+			return nil, fmt.Errorf("failed to get values Secret %s: %w", nsn, err)
+		}
+
+		data, found = secret.Data[key]
+	default:
+		return nil, fmt.Errorf("unsupported valuesFrom kind %q of %s", ref.Kind, ref.Name)
+	}
+
+	if !found {
+		if ref.Optional {
+			klog.V(3).Info("Skipping the optional values ", ref.Kind, " ", nsn, " key ", key)
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("key %s not found in values %s %s", key, ref.Kind, nsn)
+	}
+
+	if ref.TargetPath != "" {
+		values, err := targetPathValues(ref.TargetPath, string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to set key %s of values %s %s at %s: %w", key, ref.Kind, nsn, ref.TargetPath, err)
+		}
+
+		return values, nil
+	}
+
+	values := map[string]interface{}{}
+
+	err := yaml.Unmarshal(data, &values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key %s of values %s %s: %w", key, ref.Kind, nsn, err)
+	}
+
+	return values, nil
+}
+
+// targetPathValues returns the values holding the value at the dot separated target path, the value is set as a
+// literal string without the escaping and list parsing of --set
+func targetPathValues(targetPath, value string) (map[string]interface{}, error) {
+	segments := strings.Split(targetPath, ".")
+
+	var values interface{} = value
+
+	for i := len(segments) - 1; i >= 0; i-- {
+		if segments[i] == "" {
+			return nil, fmt.Errorf("empty segment in target path %q", targetPath)
+		}
+
+		values = map[string]interface{}{segments[i]: values}
+	}
+
+	return values.(map[string]interface{}), nil
+}
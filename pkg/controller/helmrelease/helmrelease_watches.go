@@ -0,0 +1,145 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helmrelease
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ghodss/yaml"
+	libhandler "github.com/operator-framework/operator-lib/handler"
+	libpredicate "github.com/operator-framework/operator-lib/predicate"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+	"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/internal/util/k8sutil"
+)
+
+// dependentWatchKey identifies a watch of the release resources, the resources a HelmRelease can own
+// are watched through their owner reference and the other ones through their owner annotations
+type dependentWatchKey struct {
+	gvk      schema.GroupVersionKind
+	ownerRef bool
+}
+
+// dependentWatches enqueues the HelmRelease of a release resource when the resource is deleted or changed,
+// each kind is watched once for all the HelmReleases
+type dependentWatches struct {
+	controller controller.Controller
+	restMapper meta.RESTMapper
+	// namespaces restrict the watches, the cluster scoped kinds are not watched when they are set
+	namespaces []string
+
+	mutex   sync.Mutex
+	watches map[dependentWatchKey]bool
+}
+
+func newDependentWatches(c controller.Controller, restMapper meta.RESTMapper, namespaces []string) *dependentWatches {
+	return &dependentWatches{
+		controller: c,
+		restMapper: restMapper,
+		namespaces: namespaces,
+		watches:    map[dependentWatchKey]bool{},
+	}
+}
+
+// watchRelease adds the missing watches of the kinds of the resources of the release manifest
+func (w *dependentWatches) watchRelease(hr *appv1.HelmRelease, manifest string) error {
+	owner := &unstructured.Unstructured{}
+	owner.SetGroupVersionKind(appv1.SchemeGroupVersion.WithKind("HelmRelease"))
+	owner.SetNamespace(hr.GetNamespace())
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for _, resource := range releaseutil.SplitManifests(manifest) {
+		dependent := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(resource), dependent); err != nil {
+			return fmt.Errorf("failed to parse the release manifest: %w", err)
+		}
+
+		gvk := dependent.GroupVersionKind()
+		if gvk.Kind == "" {
+			continue
+		}
+
+		mapping, err := w.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return fmt.Errorf("failed to get the scope of %s: %w", gvk, err)
+		}
+
+		// the manager cache watches the cluster scoped kinds in all the namespaces, the operator restricted to
+		// namespaces may not be allowed to list them and the watch would wait for its sync forever
+		if mapping.Scope.Name() == meta.RESTScopeNameRoot && len(w.namespaces) > 0 {
+			klog.V(1).Info("Not watching the cluster scoped release resources of kind ", gvk,
+				" of HelmRelease ", hr.GetNamespace(), "/", hr.GetName())
+
+			continue
+		}
+
+		if dependent.GetNamespace() == "" {
+			dependent.SetNamespace(hr.GetNamespace())
+		}
+
+		useOwnerRef, err := k8sutil.SupportsOwnerReference(w.restMapper, owner, dependent)
+		if err != nil {
+			return fmt.Errorf("failed to get the scope of %s: %w", gvk, err)
+		}
+
+		// the resources kept on uninstall get the owner annotations instead of the owner reference
+		policy := dependent.GetAnnotations()[kube.ResourcePolicyAnno]
+		if strings.EqualFold(strings.TrimSpace(policy), kube.KeepPolicy) {
+			useOwnerRef = false
+		}
+
+		key := dependentWatchKey{gvk: gvk, ownerRef: useOwnerRef}
+		if w.watches[key] {
+			continue
+		}
+
+		var eventHandler handler.EventHandler = &libhandler.EnqueueRequestForAnnotation{
+			Type: owner.GroupVersionKind().GroupKind(),
+		}
+
+		if useOwnerRef {
+			eventHandler = &handler.EnqueueRequestForOwner{OwnerType: &appv1.HelmRelease{}, IsController: true}
+		}
+
+		watched := &unstructured.Unstructured{}
+		watched.SetGroupVersionKind(gvk)
+
+		if err := w.controller.Watch(&source.Kind{Type: watched}, eventHandler,
+			libpredicate.DependentPredicate{}); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", gvk, err)
+		}
+
+		w.watches[key] = true
+
+		klog.Info("Watching the release resources of kind ", gvk, " ownerReference=", useOwnerRef)
+	}
+
+	return nil
+}
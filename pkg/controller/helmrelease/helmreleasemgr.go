@@ -20,13 +20,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/ghodss/yaml"
 
 	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/storage"
 
 	helmclient "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/client"
@@ -34,6 +39,7 @@ import (
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/kube"
 	"helm.sh/helm/v3/pkg/storage/driver"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/klog"
@@ -45,6 +51,27 @@ import (
 	"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/utils"
 )
 
+// chartsDirMutex guards the creation of the temporary charts directory
+var chartsDirMutex sync.Mutex
+
+// chartsDir returns ChartsDir, a temporary directory is created once for the process when it is not set so the
+// chart cache and the cloned charts are kept across the reconciles
+func chartsDir() (string, error) {
+	chartsDirMutex.Lock()
+	defer chartsDirMutex.Unlock()
+
+	if ChartsDir == "" {
+		dir, err := ioutil.TempDir("/tmp", "charts")
+		if err != nil {
+			return "", fmt.Errorf("failed to create the charts directory: %w", err)
+		}
+
+		ChartsDir = dir
+	}
+
+	return ChartsDir, nil
+}
+
 //newHelmOperatorManagerFactory create a new manager returns a helmManagerFactory
 func (r ReconcileHelmRelease) newHelmOperatorManagerFactory(
 	s *appv1.HelmRelease) (helmoperator.ManagerFactory, error) {
@@ -52,14 +79,57 @@ func (r ReconcileHelmRelease) newHelmOperatorManagerFactory(
 		return helmoperator.NewManagerFactory(r.Manager, ""), nil
 	}
 
-	chartDir, err := downloadChart(r.GetClient(), s)
+	chartDir, commitID, sourceURL, err := downloadChart(r.GetClient(), s)
 	if err != nil {
 		klog.Error(err, " - Failed to download the chart")
+
+		if s.Repo.Verify != nil && errors.Is(err, utils.ErrProvenanceVerification) {
+			s.Status.SetCondition(appv1.HelmAppCondition{
+				Type:    appv1.ConditionVerified,
+				Status:  appv1.StatusFalse,
+				Reason:  appv1.ReasonVerificationError,
+				Message: err.Error(),
+			})
+		}
+
 		return nil, err
 	}
 
 	klog.V(3).Info("ChartDir: ", chartDir)
 
+	if s.Repo.Verify != nil {
+		s.Status.SetCondition(appv1.HelmAppCondition{
+			Type:    appv1.ConditionVerified,
+			Status:  appv1.StatusTrue,
+			Reason:  appv1.ReasonVerificationSuccess,
+			Message: "chart provenance verified with keyring " + s.Repo.Verify.KeyringSecretRef.Name,
+		})
+	} else {
+		s.Status.RemoveCondition(appv1.ConditionVerified)
+	}
+
+	if s.Repo.Source != nil && (strings.EqualFold(string(s.Repo.Source.SourceType), string(appv1.HelmRepoSourceType)) ||
+		strings.EqualFold(string(s.Repo.Source.SourceType), string(appv1.OCISourceType))) {
+		chartfile, err := chartutil.LoadChartfile(filepath.Join(chartDir, chartutil.ChartfileName))
+		if err != nil {
+			klog.Error(err, " - Failed to load the chart file from ", chartDir)
+			return nil, err
+		}
+
+		if s.Status.ResolvedVersion != chartfile.Version {
+			klog.Info("Resolved chart version ", chartfile.Version, " for version ", s.Repo.Version, " of ", helmreleaseNsn(s))
+		}
+
+		s.Status.ResolvedVersion = chartfile.Version
+	}
+
+	if s.Status.ResolvedCommit != commitID && commitID != "" {
+		klog.Info("Resolved commit ", commitID, " for ", helmreleaseNsn(s))
+	}
+
+	s.Status.ResolvedCommit = commitID
+	s.Status.ResolvedURL = sourceURL
+
 	f := helmoperator.NewManagerFactory(r.Manager, chartDir)
 
 	return f, nil
@@ -79,7 +149,24 @@ func (r ReconcileHelmRelease) newHelmOperatorManager(
 		return nil, err
 	}
 
-	manager, err := factory.NewManager(o, nil)
+	// a nil spec installs the chart with its default values
+	values, _ := o.Object["spec"].(map[string]interface{})
+
+	if s.GetDeletionTimestamp() == nil {
+		values, err = getValues(r.GetAPIReader(), s, values)
+		if err != nil {
+			klog.Error(err, " - Failed to get the values of ", helmreleaseNsn(s))
+			return nil, err
+		}
+	}
+
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+
+	o.Object["spec"] = values
+
+	manager, err := factory.NewManager(o, OverrideValues)
 	if err != nil {
 		klog.Error(err, " - Failed to get helm operator manager")
 		return nil, err
@@ -88,43 +175,77 @@ func (r ReconcileHelmRelease) newHelmOperatorManager(
 	return manager, nil
 }
 
-//downloadChart downloads the chart
-func downloadChart(client client.Client, s *appv1.HelmRelease) (string, error) {
+//downloadChart downloads the chart and returns the url it was downloaded from, the commitID is only returned for
+//git sources
+func downloadChart(client client.Client, s *appv1.HelmRelease) (chartDir, commitID, sourceURL string, err error) {
 	configMap, err := utils.GetConfigMap(client, s.Namespace, s.Repo.ConfigMapRef)
 	if err != nil {
 		klog.Error(err)
-		return "", err
+		return "", "", "", err
 	}
 
 	secret, err := utils.GetSecret(client, s.Namespace, s.Repo.SecretRef)
 	if err != nil {
 		klog.Error(err, " - Failed to retrieve secret ", s.Repo.SecretRef.Name)
-		return "", err
+		return "", "", "", err
 	}
 
-	chartsDir := os.Getenv(appv1.ChartsDir)
-	if chartsDir == "" {
-		chartsDir, err = ioutil.TempDir("/tmp", "charts")
+	var keyring *corev1.Secret
+
+	if s.Repo.Verify != nil {
+		if s.Repo.Verify.KeyringSecretRef == nil {
+			return "", "", "", fmt.Errorf("%w: repo.verify.keyringSecretRef is required", utils.ErrProvenanceVerification)
+		}
+
+		keyring, err = utils.GetSecret(client, s.Namespace, s.Repo.Verify.KeyringSecretRef)
 		if err != nil {
-			klog.Error(err, " - Can not create tempdir")
-			return "", err
+			klog.Error(err, " - Failed to retrieve keyring secret ", s.Repo.Verify.KeyringSecretRef.Name)
+			return "", "", "", err
 		}
 	}
 
-	chartDir, err := utils.DownloadChart(configMap, secret, chartsDir, s)
+	dir, err := chartsDir()
+	if err != nil {
+		klog.Error(err)
+		return "", "", "", err
+	}
+
+	chartDir, commitID, sourceURL, err = utils.DownloadChart(configMap, secret, keyring, dir, s)
 	klog.V(3).Info("ChartDir: ", chartDir)
 
 	if err != nil {
 		klog.Error(err, " - Failed to download the chart")
-		return "", err
+		return "", "", "", err
+	}
+
+	return chartDir, commitID, sourceURL, nil
+}
+
+// removeReleaseCharts removes the charts cloned for the HelmRelease, the charts of the chart cache are shared by
+// the HelmReleases and only evicted by the cache
+func removeReleaseCharts(s *appv1.HelmRelease) {
+	dir, err := chartsDir()
+	if err != nil {
+		klog.Error(err)
+		return
 	}
 
-	return chartDir, nil
+	releaseDir := utils.ReleaseChartsDir(dir, s)
+
+	if err := os.RemoveAll(releaseDir); err != nil {
+		klog.Error(err, " - Failed to remove all: ", releaseDir)
+		return
+	}
+
+	// the directory of the name also holds the charts of the HelmReleases of the same name in other namespaces
+	if err := os.Remove(filepath.Dir(releaseDir)); err != nil && !os.IsNotExist(err) {
+		klog.V(5).Info("Keeping ", filepath.Dir(releaseDir), ": ", err)
+	}
 }
 
 //generateResourceList generates the resource list for given HelmRelease
 func generateResourceList(mgr manager.Manager, s *appv1.HelmRelease) (kube.ResourceList, error) {
-	chartDir, err := downloadChart(mgr.GetClient(), s)
+	chartDir, _, _, err := downloadChart(mgr.GetClient(), s)
 	if err != nil {
 		klog.Error(err, " - Failed to download the chart")
 		return nil, err
@@ -145,6 +266,19 @@ func generateResourceList(mgr manager.Manager, s *appv1.HelmRelease) (kube.Resou
 		return nil, err
 	}
 
+	values, err = getValues(mgr.GetAPIReader(), s, values)
+	if err != nil {
+		klog.Error(err, " - Failed to get the values of ", helmreleaseNsn(s))
+		return nil, err
+	}
+
+	overrides, err := helmoperator.ParseOverrides(OverrideValues)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse override values: %w", err)
+	}
+
+	values = helmoperator.MergeMaps(values, overrides)
+
 	klog.V(3).Info("ChartDir: ", chartDir)
 
 	chart, err := loader.LoadDir(chartDir)
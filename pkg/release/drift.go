@@ -0,0 +1,197 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/kube"
+	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/klog"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+)
+
+const (
+	// DriftModified is the drift reason of the live objects differing from the release manifest
+	DriftModified = "Modified"
+	// DriftMissing is the drift reason of the release resources without live object
+	DriftMissing = "Missing"
+)
+
+// DetectDrift compares the resources of the deployed release manifest with their live objects. Only the fields
+// set by the manifest are compared, the fields added by the API server or by the other controllers are ignored.
+// The missing resources are created and the modified ones patched back to the manifest when correct is set.
+func (m manager) DetectDrift(ctx context.Context, correct bool) ([]appv1.HelmAppDriftedResource, error) {
+	return m.detectDrift(ctx, correct, false)
+}
+
+// CreateMissingResources creates the resources of the deployed release manifest without live object, like
+// a resource deleted by accident, and returns them. The live objects are not compared with the manifest.
+func (m manager) CreateMissingResources(ctx context.Context) ([]appv1.HelmAppDriftedResource, error) {
+	return m.detectDrift(ctx, true, true)
+}
+
+// detectDrift returns the drifted resources of the deployed release manifest and corrects them when correct
+// is set, only the missing resources are looked for when missingOnly is set
+func (m manager) detectDrift(_ context.Context, correct, missingOnly bool) ([]appv1.HelmAppDriftedResource, error) {
+	deployedRelease := m.deployedRelease
+	if deployedRelease == nil {
+		var err error
+
+		deployedRelease, err = m.GetDeployedRelease()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deployed release: %w", err)
+		}
+	}
+
+	resources, err := m.kubeClient.Build(bytes.NewBufferString(deployedRelease.Manifest), false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the release resources: %w", err)
+	}
+
+	drifted := []appv1.HelmAppDriftedResource{}
+
+	err = resources.Visit(func(expected *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		helper := resource.NewHelper(expected.Client, expected.Mapping)
+
+		live, err := helper.Get(expected.Namespace, expected.Name)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get %s: %w", expected.ObjectName(), err)
+		}
+
+		gvk := expected.Object.GetObjectKind().GroupVersionKind()
+		drift := appv1.HelmAppDriftedResource{
+			APIVersion: gvk.GroupVersion().String(),
+			Kind:       gvk.Kind,
+			Namespace:  expected.Namespace,
+			Name:       expected.Name,
+		}
+
+		if apierrors.IsNotFound(err) {
+			drift.Reason = DriftMissing
+			drifted = append(drifted, drift)
+
+			if !correct {
+				return nil
+			}
+
+			klog.Info("Creating missing release resource ", expected.ObjectName(), " of ", m.releaseName)
+
+			if _, err := helper.Create(expected.Namespace, true, expected.Object); err != nil {
+				return fmt.Errorf("failed to create %s: %w", expected.ObjectName(), err)
+			}
+
+			return nil
+		}
+
+		if missingOnly {
+			return nil
+		}
+
+		patch, patchType, err := driftPatch(expected, live)
+		if err != nil {
+			return fmt.Errorf("failed to compare %s: %w", expected.ObjectName(), err)
+		}
+
+		if patch == nil {
+			return nil
+		}
+
+		drift.Reason = DriftModified
+		drifted = append(drifted, drift)
+
+		klog.V(1).Info("Release resource ", expected.ObjectName(), " of ", m.releaseName, " drifted: ", string(patch))
+
+		if !correct {
+			return nil
+		}
+
+		klog.Info("Patching drifted release resource ", expected.ObjectName(), " of ", m.releaseName)
+
+		if _, err := helper.Patch(expected.Namespace, expected.Name, patchType, patch, nil); err != nil {
+			return fmt.Errorf("failed to patch %s: %w", expected.ObjectName(), err)
+		}
+
+		return nil
+	})
+
+	return drifted, err
+}
+
+// driftPatch returns the patch bringing the fields of the live object set by the expected object back to their
+// expected value, nil when they match. Like helm, strategic merge patches are used for the built-in kinds and
+// JSON merge patches for the custom resources and the CRDs.
+func driftPatch(expected *resource.Info, live runtime.Object) ([]byte, types.PatchType, error) {
+	expectedJSON, err := json.Marshal(expected.Object)
+	if err != nil {
+		return nil, "", err
+	}
+
+	liveJSON, err := json.Marshal(live)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var (
+		patch     []byte
+		patchType types.PatchType
+	)
+
+	versioned := kube.AsVersioned(expected)
+	_, isUnstructured := versioned.(runtime.Unstructured)
+	_, isCRD := versioned.(*apiextv1beta1.CustomResourceDefinition)
+
+	if isUnstructured || isCRD {
+		patchType = types.MergePatchType
+		patch, err = jsonmergepatch.CreateThreeWayJSONMergePatch(expectedJSON, expectedJSON, liveJSON)
+	} else {
+		patchType = types.StrategicMergePatchType
+
+		var patchMeta strategicpatch.LookupPatchMeta
+
+		patchMeta, err = strategicpatch.NewPatchMetaFromStruct(versioned)
+		if err != nil {
+			return nil, "", err
+		}
+
+		patch, err = strategicpatch.CreateThreeWayMergePatch(expectedJSON, expectedJSON, liveJSON, patchMeta, true)
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if string(patch) == "{}" {
+		return nil, patchType, nil
+	}
+
+	return patch, patchType, nil
+}
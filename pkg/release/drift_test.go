@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+func TestDriftPatch(t *testing.T) {
+	expected := &resource.Info{
+		Object: newTestDeployment([]v1.Container{{Name: "test", Image: "test:1.0"}}),
+		Mapping: &meta.RESTMapping{
+			GroupVersionKind: appsv1.SchemeGroupVersion.WithKind("Deployment"),
+		},
+	}
+
+	// the fields added by the API server are not a drift
+	live := newTestDeployment([]v1.Container{{Name: "test", Image: "test:1.0", TerminationMessagePath: "/dev/termination-log"}})
+	live.Status.Replicas = 1
+
+	patch, _, err := driftPatch(expected, live)
+	assert.NoError(t, err)
+	assert.Nil(t, patch)
+
+	live.Spec.Template.Spec.Containers[0].Image = "test:2.0"
+
+	patch, patchType, err := driftPatch(expected, live)
+	assert.NoError(t, err)
+	assert.Equal(t, types.StrategicMergePatchType, patchType)
+	assert.JSONEq(t, `{"spec":{"template":{"spec":{"$setElementOrder/containers":[{"name":"test"}],`+
+		`"containers":[{"image":"test:1.0","name":"test"}]}}}}`, string(patch))
+
+	expected = &resource.Info{
+		Object: newTestUnstructured([]interface{}{map[string]interface{}{"name": "test", "image": "test:1.0"}}),
+	}
+
+	patch, _, err = driftPatch(expected, expected.Object.DeepCopyObject())
+	assert.NoError(t, err)
+	assert.Nil(t, patch)
+
+	patch, patchType, err = driftPatch(expected,
+		newTestUnstructured([]interface{}{map[string]interface{}{"name": "test", "image": "test:2.0"}}))
+	assert.NoError(t, err)
+	assert.Equal(t, types.MergePatchType, patchType)
+	assert.JSONEq(t, `{"spec":{"template":{"spec":{"containers":[{"image":"test:1.0","name":"test"}]}}}}`, string(patch))
+}
@@ -18,9 +18,12 @@ package release
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"k8s.io/klog"
 
@@ -40,11 +43,16 @@ type Manager interface {
 	ReleaseName() string
 	IsInstalled() bool
 	IsUpgradeRequired() bool
+	ValuesDigest() string
 	Sync(context.Context) error
 	InstallRelease(context.Context, ...InstallOption) (*rpb.Release, error)
 	UpgradeRelease(context.Context, ...UpgradeOption) (*rpb.Release, *rpb.Release, error)
+	ReplaceCRDs(context.Context) error
 	UninstallRelease(context.Context, ...UninstallOption) (*rpb.Release, error)
-	RollbackRelease(context.Context) error
+	RollbackRelease(context.Context, ...RollbackOption) error
+	TestRelease(context.Context, ...TestOption) (*rpb.Release, error)
+	DetectDrift(ctx context.Context, correct bool) ([]appv1.HelmAppDriftedResource, error)
+	CreateMissingResources(ctx context.Context) ([]appv1.HelmAppDriftedResource, error)
 	GetDeployedRelease() (*rpb.Release, error)
 	GetActionConfig() *action.Configuration
 }
@@ -69,6 +77,8 @@ type manager struct {
 type InstallOption func(*action.Install) error
 type UpgradeOption func(*action.Upgrade) error
 type UninstallOption func(*action.Uninstall) error
+type RollbackOption func(*action.Rollback) error
+type TestOption func(*action.ReleaseTesting) error
 
 func (m manager) GetActionConfig() *action.Configuration {
 	return m.actionConfig
@@ -87,6 +97,18 @@ func (m manager) IsUpgradeRequired() bool {
 	return m.isUpgradeRequired
 }
 
+// ValuesDigest returns the sha256 digest of the values of the release
+func (m manager) ValuesDigest() string {
+	// the keys of the maps are marshalled in order
+	values, err := json.Marshal(m.values)
+	if err != nil {
+		klog.Error("Failed to marshal the values of release ", m.namespace, "/", m.releaseName, " ", err)
+		return ""
+	}
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(values))
+}
+
 // Sync ensures the Helm storage backend is in sync with the status of the
 // custom resource.
 func (m *manager) Sync(ctx context.Context) error {
@@ -125,13 +147,23 @@ func (m *manager) Sync(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to get candidate release: %w", err)
 	}
-	if deployedRelease.Manifest != candidateRelease.Manifest {
+	if deployedRelease.Manifest != candidateRelease.Manifest || chartVersionChanged(deployedRelease.Chart, m.chart) {
 		m.isUpgradeRequired = true
 	}
 
 	return nil
 }
 
+// chartVersionChanged returns true if the chart of the deployed release is a different version
+// than the chart of the candidate release, e.g. after a semver range resolved to a newer version.
+func chartVersionChanged(deployed, candidate *cpb.Chart) bool {
+	if deployed == nil || deployed.Metadata == nil || candidate == nil || candidate.Metadata == nil {
+		return false
+	}
+
+	return deployed.Metadata.Version != candidate.Metadata.Version
+}
+
 func notFoundErr(err error) bool {
 	return err != nil && strings.Contains(err.Error(), "not found")
 }
@@ -169,6 +201,25 @@ func (m manager) InstallRelease(ctx context.Context, opts ...InstallOption) (*rp
 	return install.Run(m.chart, m.values)
 }
 
+// InstallWait waits for the release resources to be ready, and for its jobs to complete when waitForJobs
+// is set. The timeout applies to the wait and to the hooks.
+func InstallWait(wait, waitForJobs bool, timeout time.Duration) InstallOption {
+	return func(i *action.Install) error {
+		i.Wait = wait
+		i.WaitForJobs = waitForJobs
+		i.Timeout = timeout
+		return nil
+	}
+}
+
+// InstallSkipCRDs does not create the CRDs of the crds directory of the chart
+func InstallSkipCRDs(skip bool) InstallOption {
+	return func(i *action.Install) error {
+		i.SkipCRDs = skip
+		return nil
+	}
+}
+
 func ForceUpgrade(force bool) UpgradeOption {
 	return func(u *action.Upgrade) error {
 		u.Force = force
@@ -176,6 +227,25 @@ func ForceUpgrade(force bool) UpgradeOption {
 	}
 }
 
+// UpgradeMaxHistory limits the number of revisions kept in the storage backend, 0 keeps all of them
+func UpgradeMaxHistory(maxHistory int) UpgradeOption {
+	return func(u *action.Upgrade) error {
+		u.MaxHistory = maxHistory
+		return nil
+	}
+}
+
+// UpgradeWait waits for the release resources to be ready, and for its jobs to complete when waitForJobs
+// is set. The timeout applies to the wait and to the hooks.
+func UpgradeWait(wait, waitForJobs bool, timeout time.Duration) UpgradeOption {
+	return func(u *action.Upgrade) error {
+		u.Wait = wait
+		u.WaitForJobs = waitForJobs
+		u.Timeout = timeout
+		return nil
+	}
+}
+
 // UpgradeRelease performs a Helm release upgrade.
 func (m manager) UpgradeRelease(ctx context.Context, opts ...UpgradeOption) (*rpb.Release, *rpb.Release, error) {
 	upgrade := action.NewUpgrade(m.actionConfig)
@@ -193,6 +263,47 @@ func (m manager) UpgradeRelease(ctx context.Context, opts ...UpgradeOption) (*rp
 	return m.deployedRelease, upgradedRelease, err
 }
 
+// ReplaceCRDs creates the missing CRDs of the crds directory of the chart and replaces the existing ones, helm
+// only creates them on install.
+func (m manager) ReplaceCRDs(ctx context.Context) error {
+	var builder strings.Builder
+
+	for _, crd := range m.chart.CRDObjects() {
+		builder.WriteString("\n---\n" + string(crd.File.Data))
+	}
+
+	if builder.Len() == 0 {
+		return nil
+	}
+
+	crds, err := m.kubeClient.Build(strings.NewReader(builder.String()), false)
+	if err != nil {
+		return fmt.Errorf("failed to build the CRDs of the chart: %w", err)
+	}
+
+	result, err := m.kubeClient.Update(crds, crds, true)
+	if err != nil {
+		return fmt.Errorf("failed to replace the CRDs of the chart: %w", err)
+	}
+
+	klog.Info("Replaced the CRDs of release ", m.namespace, "/", m.releaseName, " created=", len(result.Created),
+		" updated=", len(result.Updated))
+
+	if len(result.Created) == 0 {
+		return nil
+	}
+
+	// the discovery cache does not know the created CRDs yet
+	discoveryClient, err := m.actionConfig.RESTClientGetter.ToDiscoveryClient()
+	if err != nil {
+		return err
+	}
+
+	discoveryClient.Invalidate()
+
+	return m.kubeClient.Wait(result.Created, time.Minute)
+}
+
 // UninstallRelease performs a Helm release uninstall.
 func (m manager) UninstallRelease(ctx context.Context, opts ...UninstallOption) (*rpb.Release, error) {
 	uninstall := action.NewUninstall(m.actionConfig)
@@ -210,10 +321,44 @@ func (m manager) UninstallRelease(ctx context.Context, opts ...UninstallOption)
 	return uninstallResponse.Release, err
 }
 
-// RollbackRelease performs a Helm release rollback.
-func (m manager) RollbackRelease(ctx context.Context) error {
+// RollbackMaxHistory limits the number of revisions kept in the storage backend, 0 keeps all of them
+func RollbackMaxHistory(maxHistory int) RollbackOption {
+	return func(r *action.Rollback) error {
+		r.MaxHistory = maxHistory
+		return nil
+	}
+}
+
+// RollbackRelease performs a Helm release rollback to the previous revision.
+func (m manager) RollbackRelease(ctx context.Context, opts ...RollbackOption) error {
 	rollback := action.NewRollback(m.actionConfig)
 	rollback.Force = true
+	for _, o := range opts {
+		if err := o(rollback); err != nil {
+			return fmt.Errorf("failed to apply rollback option: %w", err)
+		}
+	}
 
 	return rollback.Run(m.releaseName)
 }
+
+// TestTimeout sets the timeout of each test hook
+func TestTimeout(timeout time.Duration) TestOption {
+	return func(t *action.ReleaseTesting) error {
+		t.Timeout = timeout
+		return nil
+	}
+}
+
+// TestRelease runs the test hooks of the release, the hooks of the returned release hold their last run.
+func (m manager) TestRelease(ctx context.Context, opts ...TestOption) (*rpb.Release, error) {
+	test := action.NewReleaseTesting(m.actionConfig)
+	test.Namespace = m.namespace
+	for _, o := range opts {
+		if err := o(test); err != nil {
+			return nil, fmt.Errorf("failed to apply test option: %w", err)
+		}
+	}
+
+	return test.Run(m.releaseName)
+}
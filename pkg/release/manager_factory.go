@@ -25,7 +25,6 @@ import (
 	"helm.sh/helm/v3/pkg/kube"
 	helmrelease "helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/storage"
-	"helm.sh/helm/v3/pkg/storage/driver"
 	"helm.sh/helm/v3/pkg/strvals"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
@@ -59,7 +58,7 @@ func (f managerFactory) NewManager(cr *unstructured.Unstructured, overrideValues
 	if err != nil {
 		return nil, fmt.Errorf("failed to get core/v1 client: %w", err)
 	}
-	storageBackend := storage.Init(driver.NewSecrets(clientv1.Secrets(cr.GetNamespace())))
+	storageBackend := NewStorage(clientv1.Secrets(cr.GetNamespace()), cr.GetUID())
 
 	// Get the necessary clients and client getters. Use a client that injects the CR
 	// as an owner reference into all resources templated by the chart.
@@ -96,11 +95,11 @@ func (f managerFactory) NewManager(cr *unstructured.Unstructured, overrideValues
 		return nil, fmt.Errorf("failed to get spec: expected map[string]interface{}")
 	}
 
-	expOverrides, err := parseOverrides(overrideValues)
+	expOverrides, err := ParseOverrides(overrideValues)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse override values: %w", err)
 	}
-	values := mergeMaps(crValues, expOverrides)
+	values := MergeMaps(crValues, expOverrides)
 
 	actionConfig := &action.Configuration{
 		RESTClientGetter: rcg,
@@ -177,7 +176,8 @@ func releaseHistory(storageBackend *storage.Storage, releaseName string) ([]*hel
 	return releaseHistory, len(releaseHistory) > 0, nil
 }
 
-func parseOverrides(in map[string]string) (map[string]interface{}, error) {
+// ParseOverrides parses the key.path=value overrides in the helm --set format into values.
+func ParseOverrides(in map[string]string) (map[string]interface{}, error) {
 	out := make(map[string]interface{})
 	for k, v := range in {
 		val := fmt.Sprintf("%s=%s", k, v)
@@ -188,7 +188,8 @@ func parseOverrides(in map[string]string) (map[string]interface{}, error) {
 	return out, nil
 }
 
-func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
+// MergeMaps returns a deep merge of b into a, the values of b take precedence.
+func MergeMaps(a, b map[string]interface{}) map[string]interface{} {
 	out := make(map[string]interface{}, len(a))
 	for k, v := range a {
 		out[k] = v
@@ -197,7 +198,7 @@ func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
 		if v, ok := v.(map[string]interface{}); ok {
 			if bv, ok := out[k]; ok {
 				if bv, ok := bv.(map[string]interface{}); ok {
-					out[k] = mergeMaps(bv, v)
+					out[k] = MergeMaps(bv, v)
 					continue
 				}
 			}
@@ -17,6 +17,9 @@
 package release
 
 import (
+	"testing"
+
+	cpb "helm.sh/helm/v3/pkg/chart"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -57,3 +60,22 @@ func newTestDeployment(containers []v1.Container) *appsv1.Deployment {
 		},
 	}
 }
+
+func TestChartVersionChanged(t *testing.T) {
+	deployed := &cpb.Chart{Metadata: &cpb.Metadata{Name: "nginx", Version: "1.4.0"}}
+	candidate := &cpb.Chart{Metadata: &cpb.Metadata{Name: "nginx", Version: "1.4.0"}}
+
+	if chartVersionChanged(deployed, candidate) {
+		t.Error("expected the chart version to be unchanged")
+	}
+
+	candidate.Metadata.Version = "1.4.1"
+
+	if !chartVersionChanged(deployed, candidate) {
+		t.Error("expected the chart version to be changed")
+	}
+
+	if chartVersionChanged(nil, candidate) {
+		t.Error("expected a missing deployed chart to be ignored")
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// HelmReleaseUIDLabel is the label of the storage secrets of the helm releases deployed for a HelmRelease, its
+// value is the UID of the HelmRelease. The releases without it were deployed by another tool.
+const HelmReleaseUIDLabel = "apps.open-cluster-management.io/helmrelease-uid"
+
+// NewStorage returns the helm release storage of the secrets, the secrets created or updated by the storage are
+// labeled with the uid of the HelmRelease
+func NewStorage(secrets v1.SecretInterface, uid types.UID) *storage.Storage {
+	return storage.Init(driver.NewSecrets(&labeledSecrets{SecretInterface: secrets, uid: string(uid)}))
+}
+
+// labeledSecrets adds the HelmReleaseUIDLabel to the storage secrets written by the helm secrets driver, the
+// driver sets its own labels on every write
+type labeledSecrets struct {
+	v1.SecretInterface
+	uid string
+}
+
+func (s *labeledSecrets) Create(ctx context.Context, secret *corev1.Secret,
+	opts metav1.CreateOptions) (*corev1.Secret, error) {
+	return s.SecretInterface.Create(ctx, s.label(secret), opts)
+}
+
+func (s *labeledSecrets) Update(ctx context.Context, secret *corev1.Secret,
+	opts metav1.UpdateOptions) (*corev1.Secret, error) {
+	return s.SecretInterface.Update(ctx, s.label(secret), opts)
+}
+
+func (s *labeledSecrets) label(secret *corev1.Secret) *corev1.Secret {
+	if s.uid == "" {
+		return secret
+	}
+
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+
+	secret.Labels[HelmReleaseUIDLabel] = s.uid
+
+	return secret
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	rpb "helm.sh/helm/v3/pkg/release"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNewStorage(t *testing.T) {
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets("default")
+	storageBackend := NewStorage(secrets, "0c1d6ed6-ab36-4bd6-8a2b-2f0ef8c3c1a8")
+
+	rls := &rpb.Release{Name: "example", Namespace: "default", Version: 1, Info: &rpb.Info{Status: rpb.StatusDeployed}}
+	assert.NoError(t, storageBackend.Create(rls))
+
+	secret, err := secrets.Get(context.TODO(), "sh.helm.release.v1.example.v1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "0c1d6ed6-ab36-4bd6-8a2b-2f0ef8c3c1a8", secret.Labels[HelmReleaseUIDLabel])
+	assert.Equal(t, "helm", secret.Labels["owner"])
+
+	// the label is kept when the driver replaces the labels of the release
+	rls.Info.Status = rpb.StatusSuperseded
+	assert.NoError(t, storageBackend.Update(rls))
+
+	secret, err = secrets.Get(context.TODO(), "sh.helm.release.v1.example.v1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "0c1d6ed6-ab36-4bd6-8a2b-2f0ef8c3c1a8", secret.Labels[HelmReleaseUIDLabel])
+	assert.Equal(t, "superseded", secret.Labels["status"])
+}
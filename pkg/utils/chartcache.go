@@ -0,0 +1,403 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	//ChartCacheDirName is the directory of the chart cache in the charts dir
+	ChartCacheDirName = ".cache"
+	//chartCacheSumFile holds the sha256 and the file name of the archive of a cache entry
+	chartCacheSumFile = "sha256sum"
+	//chartCacheExpandDir holds the chart expanded from the archive of an entry, shared by the HelmReleases
+	chartCacheExpandDir = "expanded"
+	//chartCacheIndexFile is the file name of the helm repo index of an index entry
+	chartCacheIndexFile = "index.yaml"
+	//chartCacheMinAge protects the entries used recently, they may still be expanded by another reconcile
+	chartCacheMinAge = time.Minute
+)
+
+var (
+	//ChartCacheMaxSize is the size in bytes above which the least recently used chart cache entries are evicted
+	ChartCacheMaxSize int64 = 1 << 30
+	//ChartCacheMaxAge is the duration after which the unused chart cache entries are evicted
+	ChartCacheMaxAge = time.Hour * 24 * 7
+	//ChartCacheIndexTTL is the duration a helm repo index is used before it is downloaded again
+	ChartCacheIndexTTL = time.Minute * 5
+
+	chartCacheLocks      sync.Map
+	chartCacheEvictMutex sync.Mutex
+
+	chartCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "helmrelease_chart_cache_hits_total",
+		Help: "Number of chart archives served from the chart cache",
+	})
+	chartCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "helmrelease_chart_cache_misses_total",
+		Help: "Number of chart archives downloaded into the chart cache",
+	})
+	chartCacheEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "helmrelease_chart_cache_evictions_total",
+		Help: "Number of chart cache entries evicted because of their age, the cache size or a failed integrity check",
+	})
+	chartCacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "helmrelease_chart_cache_size_bytes",
+		Help: "Size of the chart cache after the last eviction",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(chartCacheHits, chartCacheMisses, chartCacheEvictions, chartCacheSize)
+}
+
+//ChartCache is a cache of chart archives shared by the HelmReleases. Each entry is a directory named
+//after the ChartCacheKey holding the archive under its original name, its provenance file when it
+//was verified, the sha256 of the archive and the chart expanded from the archive. The helm repo
+//index files are cached in their own entries.
+type ChartCache struct {
+	Dir      string
+	MaxSize  int64
+	MaxAge   time.Duration
+	IndexTTL time.Duration
+}
+
+//NewChartCache returns the chart cache of the chartsDir limited by ChartCacheMaxSize and ChartCacheMaxAge,
+//the index files are used for ChartCacheIndexTTL
+func NewChartCache(chartsDir string) *ChartCache {
+	return &ChartCache{
+		Dir:      filepath.Join(chartsDir, ChartCacheDirName),
+		MaxSize:  ChartCacheMaxSize,
+		MaxAge:   ChartCacheMaxAge,
+		IndexTTL: ChartCacheIndexTTL,
+	}
+}
+
+//ChartCacheKey returns the cache key of a chart archive. The credentials of the secret are part of the key
+//so an archive downloaded with credentials is only served to the HelmReleases using the same credentials.
+func ChartCacheKey(url, version, digest string, secret *corev1.Secret) string {
+	sum := sha256.Sum256([]byte(url + "\n" + version + "\n" + strings.TrimPrefix(digest, "sha256:") + "\n" +
+		credentialsDigest(secret)))
+
+	return hex.EncodeToString(sum[:])
+}
+
+//credentialsDigest returns the sha256 of the data of the secret, empty without secret
+func credentialsDigest(secret *corev1.Secret) string {
+	if secret == nil || len(secret.Data) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	hash := sha256.New()
+
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s\n%d\n", key, len(secret.Data[key]))
+		hash.Write(secret.Data[key])
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+//Fetch returns the archive of the key entry, on a miss download is called to write the archive in
+//the entry directory and return its path. The archive is checked against the digest when it is not
+//empty and on every hit against the sha256 recorded when the entry was created.
+func (c *ChartCache) Fetch(key, digest string, download func(entryDir string) (string, error)) (string, error) {
+	lock, _ := chartCacheLocks.LoadOrStore(key, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	entryDir := filepath.Join(c.Dir, key)
+
+	chartZip, err := c.lookup(entryDir, digest)
+	if err == nil {
+		klog.V(5).Info("Chart cache hit: ", chartZip)
+		chartCacheHits.Inc()
+
+		now := time.Now()
+		if err := os.Chtimes(entryDir, now, now); err != nil {
+			klog.Error(err, " - Failed to touch the chart cache entry ", entryDir)
+		}
+
+		return chartZip, nil
+	}
+
+	if !os.IsNotExist(err) {
+		klog.Error(err, " - Evicting the invalid chart cache entry ", entryDir)
+		chartCacheEvictions.Inc()
+	}
+
+	chartCacheMisses.Inc()
+
+	c.Remove(key)
+
+	err = os.MkdirAll(entryDir, 0750)
+	if err != nil {
+		return "", err
+	}
+
+	chartZip, err = download(entryDir)
+	if err == nil && digest != "" {
+		err = VerifyDigest(chartZip, digest)
+	}
+
+	var sum string
+
+	if err == nil {
+		sum, err = fileSha256(chartZip)
+	}
+
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(entryDir, chartCacheSumFile),
+			[]byte(sum+"  "+filepath.Base(chartZip)+"\n"), 0600)
+	}
+
+	if err != nil {
+		c.Remove(key)
+		return "", err
+	}
+
+	c.Evict()
+
+	return chartZip, nil
+}
+
+//FetchIndex returns the helm repo index of indexURL downloaded with the credentials of the secret, download is
+//called to write the index in the entry directory and return its path when it is missing or older than IndexTTL
+func (c *ChartCache) FetchIndex(indexURL string, secret *corev1.Secret,
+	download func(entryDir string) (string, error)) (string, error) {
+	key := chartCacheIndexKey(indexURL, secret)
+
+	lock, _ := chartCacheLocks.LoadOrStore(key, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	entryDir := filepath.Join(c.Dir, key)
+	indexFile := filepath.Join(entryDir, chartCacheIndexFile)
+
+	if info, err := os.Stat(indexFile); err == nil && time.Since(info.ModTime()) < c.IndexTTL {
+		klog.V(5).Info("Index cache hit: ", indexFile)
+		return indexFile, nil
+	}
+
+	c.Remove(key)
+
+	err := os.MkdirAll(entryDir, 0750)
+	if err != nil {
+		return "", err
+	}
+
+	downloaded, err := download(entryDir)
+	if err == nil && downloaded != indexFile {
+		err = os.Rename(downloaded, indexFile)
+	}
+
+	if err != nil {
+		c.Remove(key)
+		return "", err
+	}
+
+	return indexFile, nil
+}
+
+//RemoveIndex removes the helm repo index of indexURL downloaded with the credentials of the secret
+func (c *ChartCache) RemoveIndex(indexURL string, secret *corev1.Secret) {
+	c.Remove(chartCacheIndexKey(indexURL, secret))
+}
+
+//chartCacheIndexKey returns the cache key of a helm repo index
+func chartCacheIndexKey(indexURL string, secret *corev1.Secret) string {
+	return ChartCacheKey(indexURL, chartCacheIndexFile, "", secret)
+}
+
+//Expand expands the archive of the key entry once and returns the chart directory. The expanded chart
+//is shared by the HelmReleases, it is only read by the release managers.
+func (c *ChartCache) Expand(key, chartZip, chartName string) (string, error) {
+	lock, _ := chartCacheLocks.LoadOrStore(key, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	entryDir := filepath.Join(c.Dir, key)
+	expandDir := filepath.Join(entryDir, chartCacheExpandDir)
+	chartDir := filepath.Clean(filepath.Join(expandDir, chartName))
+
+	if _, err := os.Stat(chartDir); err == nil {
+		klog.V(5).Info("Skip expand, ", chartDir, " is already expanded from ", chartZip)
+		return chartDir, nil
+	}
+
+	if err := os.RemoveAll(expandDir); err != nil {
+		klog.Error(err, " - Failed to remove all: ", expandDir)
+	}
+
+	//The chart is expanded in a temporary directory renamed once complete, a partially expanded chart is never used
+	tmpDir, err := ioutil.TempDir(entryDir, chartCacheExpandDir)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = expandChart(chartZip, tmpDir, chartName)
+	if err == nil {
+		err = os.Rename(tmpDir, expandDir)
+	}
+
+	if err != nil {
+		if rErr := os.RemoveAll(tmpDir); rErr != nil {
+			klog.Error(rErr, " - Failed to remove all: ", tmpDir)
+		}
+
+		return "", err
+	}
+
+	return chartDir, nil
+}
+
+//lookup returns the archive of the entry once its integrity is checked
+func (c *ChartCache) lookup(entryDir, digest string) (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(entryDir, chartCacheSumFile))
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) != 2 {
+		return "", fmt.Errorf("invalid chart cache entry %s", entryDir)
+	}
+
+	chartZip := filepath.Join(entryDir, fields[1])
+
+	if digest != "" && strings.ToLower(strings.TrimPrefix(digest, "sha256:")) != fields[0] {
+		return "", fmt.Errorf("%w, expected %s got %s", ErrDigestMismatch, digest, fields[0])
+	}
+
+	err = VerifyDigest(chartZip, fields[0])
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("missing archive in chart cache entry %s", entryDir)
+	}
+
+	return chartZip, err
+}
+
+//Remove removes the key entry
+func (c *ChartCache) Remove(key string) {
+	entryDir := filepath.Join(c.Dir, key)
+
+	if err := os.RemoveAll(entryDir); err != nil {
+		klog.Error(err, " - Failed to remove all: ", entryDir)
+	}
+}
+
+type chartCacheEntry struct {
+	dir     string
+	size    int64
+	modTime time.Time
+}
+
+//Evict removes the entries older than MaxAge, then the least recently used entries until the cache
+//is smaller than MaxSize. Entries used within the last minute are kept.
+func (c *ChartCache) Evict() {
+	chartCacheEvictMutex.Lock()
+	defer chartCacheEvictMutex.Unlock()
+
+	infos, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		klog.Error(err, " - Failed to read the chart cache ", c.Dir)
+		return
+	}
+
+	entries := []chartCacheEntry{}
+
+	var total int64
+
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+
+		entry := chartCacheEntry{dir: filepath.Join(c.Dir, info.Name()), modTime: info.ModTime()}
+
+		err = filepath.Walk(entry.dir, func(_ string, fi os.FileInfo, err error) error {
+			if err == nil && !fi.IsDir() {
+				entry.size += fi.Size()
+			}
+
+			return nil
+		})
+		if err != nil {
+			klog.Error(err, " - Failed to walk the chart cache entry ", entry.dir)
+		}
+
+		total += entry.size
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+
+	now := time.Now()
+
+	for _, entry := range entries {
+		age := now.Sub(entry.modTime)
+		if age < chartCacheMinAge || (age < c.MaxAge && total <= c.MaxSize) {
+			continue
+		}
+
+		klog.V(3).Info("Evicting chart cache entry ", entry.dir, " of age ", age)
+
+		if err := os.RemoveAll(entry.dir); err != nil {
+			klog.Error(err, " - Failed to remove all: ", entry.dir)
+			continue
+		}
+
+		chartCacheEvictions.Inc()
+
+		total -= entry.size
+	}
+
+	chartCacheSize.Set(float64(total))
+}
+
+func fileSha256(file string) (string, error) {
+	content, err := ioutil.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestChartCacheFetch(t *testing.T) {
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	cache := NewChartCache(dir)
+	key := ChartCacheKey("https://charts.example.com/chart-0.1.0.tgz", "0.1.0", "", nil)
+
+	downloads := 0
+	download := func(entryDir string) (string, error) {
+		downloads++
+		chartZip := filepath.Join(entryDir, "chart-0.1.0.tgz")
+
+		return chartZip, ioutil.WriteFile(chartZip, []byte("chart"), 0600)
+	}
+
+	hits := testutil.ToFloat64(chartCacheHits)
+	misses := testutil.ToFloat64(chartCacheMisses)
+
+	chartZip, err := cache.Fetch(key, "", download)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, ChartCacheDirName, key, "chart-0.1.0.tgz"), chartZip)
+
+	_, err = cache.Fetch(key, "", download)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, downloads)
+	assert.Equal(t, hits+1, testutil.ToFloat64(chartCacheHits))
+	assert.Equal(t, misses+1, testutil.ToFloat64(chartCacheMisses))
+
+	// a corrupted archive is downloaded again
+	err = ioutil.WriteFile(chartZip, []byte("corrupted"), 0600)
+	assert.NoError(t, err)
+
+	_, err = cache.Fetch(key, "", download)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, downloads)
+
+	content, err := ioutil.ReadFile(chartZip)
+	assert.NoError(t, err)
+	assert.Equal(t, "chart", string(content))
+
+	// an archive not matching the digest is not cached
+	digest := "sha256:0000"
+	key = ChartCacheKey("https://charts.example.com/chart-0.1.0.tgz", "0.1.0", digest, nil)
+
+	_, err = cache.Fetch(key, digest, download)
+	assert.True(t, errors.Is(err, ErrDigestMismatch))
+
+	_, err = os.Stat(filepath.Join(dir, ChartCacheDirName, key))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestChartCacheEvict(t *testing.T) {
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	cache := NewChartCache(dir)
+	cache.MaxSize = 1 << 20
+	cache.MaxAge = time.Hour
+
+	fetch := func(name string, size int, age time.Duration) string {
+		key := ChartCacheKey(name, "", "", nil)
+
+		_, err := cache.Fetch(key, "", func(entryDir string) (string, error) {
+			chartZip := filepath.Join(entryDir, name)
+			return chartZip, ioutil.WriteFile(chartZip, make([]byte, size), 0600)
+		})
+		assert.NoError(t, err)
+
+		entryDir := filepath.Join(cache.Dir, key)
+		modTime := time.Now().Add(-age)
+		assert.NoError(t, os.Chtimes(entryDir, modTime, modTime))
+
+		return entryDir
+	}
+
+	expired := fetch("expired.tgz", 10, time.Hour*2)
+	oldest := fetch("oldest.tgz", 600<<10, time.Minute*30)
+	recent := fetch("recent.tgz", 600<<10, time.Minute*10)
+	fresh := fetch("fresh.tgz", 600<<10, 0)
+
+	cache.Evict()
+
+	_, err = os.Stat(expired)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = os.Stat(oldest)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = os.Stat(recent)
+	assert.True(t, os.IsNotExist(err))
+
+	// entries used within the last minute are never evicted
+	_, err = os.Stat(fresh)
+	assert.NoError(t, err)
+}
+
+func TestChartCacheExpand(t *testing.T) {
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	cache := NewChartCache(dir)
+	key := ChartCacheKey("https://charts.example.com/subscription-release-test-1-0.1.0.tgz", "0.1.0", "", nil)
+
+	chartZip, err := cache.Fetch(key, "", func(entryDir string) (string, error) {
+		chartZip := filepath.Join(entryDir, "subscription-release-test-1-0.1.0.tgz")
+		return chartZip, downloadFileLocal(&url.URL{Path: "../../test/helmrepo/subscription-release-test-1-0.1.0.tgz"}, chartZip)
+	})
+	assert.NoError(t, err)
+
+	chartDir, err := cache.Expand(key, chartZip, "subscription-release-test-1")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, ChartCacheDirName, key, chartCacheExpandDir, "subscription-release-test-1"), chartDir)
+
+	_, err = os.Stat(filepath.Join(chartDir, "Chart.yaml"))
+	assert.NoError(t, err)
+
+	// the chart is expanded once and shared by the HelmReleases
+	marker := filepath.Join(chartDir, "marker")
+	assert.NoError(t, ioutil.WriteFile(marker, []byte("marker"), 0600))
+
+	sharedDir, err := cache.Expand(key, chartZip, "subscription-release-test-1")
+	assert.NoError(t, err)
+	assert.Equal(t, chartDir, sharedDir)
+
+	_, err = os.Stat(marker)
+	assert.NoError(t, err)
+
+	// the expanded chart is removed with its entry
+	cache.Remove(key)
+
+	_, err = os.Stat(chartDir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestChartCacheFetchIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	cache := NewChartCache(dir)
+	indexURL := "https://charts.example.com/index.yaml"
+
+	downloads := 0
+	download := func(entryDir string) (string, error) {
+		downloads++
+		indexFile := filepath.Join(entryDir, "index.yaml")
+
+		return indexFile, ioutil.WriteFile(indexFile, []byte("apiVersion: v1\n"), 0600)
+	}
+
+	indexFile, err := cache.FetchIndex(indexURL, nil, download)
+	assert.NoError(t, err)
+
+	_, err = cache.FetchIndex(indexURL, nil, download)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, downloads)
+
+	// the index is downloaded again once older than the IndexTTL
+	old := time.Now().Add(-cache.IndexTTL)
+	assert.NoError(t, os.Chtimes(indexFile, old, old))
+
+	_, err = cache.FetchIndex(indexURL, nil, download)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, downloads)
+
+	cache.RemoveIndex(indexURL, nil)
+
+	_, err = cache.FetchIndex(indexURL, nil, download)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, downloads)
+
+	_, err = cache.FetchIndex(indexURL, nil, func(string) (string, error) {
+		return "", errors.New("download failed")
+	})
+	assert.NoError(t, err)
+
+	cache.RemoveIndex(indexURL, nil)
+
+	_, err = cache.FetchIndex(indexURL, nil, func(string) (string, error) {
+		return "", errors.New("download failed")
+	})
+	assert.Error(t, err)
+}
+
+func TestChartCacheKeyCredentials(t *testing.T) {
+	chartURL := "https://charts.example.com/chart-0.1.0.tgz"
+
+	secret := func(namespace, password string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: namespace},
+			Data:       map[string][]byte{"user": []byte("admin"), "password": []byte(password)},
+		}
+	}
+
+	public := ChartCacheKey(chartURL, "0.1.0", "", nil)
+	assert.Equal(t, public, ChartCacheKey(chartURL, "0.1.0", "", &corev1.Secret{}))
+	assert.NotEqual(t, public, ChartCacheKey(chartURL, "0.1.0", "", secret("ns1", "secret")))
+	assert.Equal(t, ChartCacheKey(chartURL, "0.1.0", "", secret("ns1", "secret")),
+		ChartCacheKey(chartURL, "0.1.0", "", secret("ns2", "secret")))
+	assert.NotEqual(t, ChartCacheKey(chartURL, "0.1.0", "", secret("ns1", "secret")),
+		ChartCacheKey(chartURL, "0.1.0", "", secret("ns2", "other")))
+
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	cache := NewChartCache(dir)
+	indexURL := "https://charts.example.com/index.yaml"
+
+	downloads := 0
+	download := func(entryDir string) (string, error) {
+		downloads++
+		indexFile := filepath.Join(entryDir, "index.yaml")
+
+		return indexFile, ioutil.WriteFile(indexFile, []byte("apiVersion: v1\n"), 0600)
+	}
+
+	// the index downloaded with credentials is not served without them or with other credentials
+	_, err = cache.FetchIndex(indexURL, secret("ns1", "secret"), download)
+	assert.NoError(t, err)
+
+	_, err = cache.FetchIndex(indexURL, nil, download)
+	assert.NoError(t, err)
+
+	_, err = cache.FetchIndex(indexURL, secret("ns2", "other"), download)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, downloads)
+
+	_, err = cache.FetchIndex(indexURL, secret("ns1", "secret"), download)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, downloads)
+}
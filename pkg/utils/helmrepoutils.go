@@ -17,9 +17,13 @@ limitations under the License.
 package utils
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
@@ -29,18 +33,46 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Masterminds/semver/v3"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 	"gopkg.in/src-d/go-git.v4"
+	gitconfig "gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
 	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
 	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/repo"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog"
 
 	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
 )
 
+var (
+	//ErrDigestMismatch is returned when a downloaded chart does not match the expected digest
+	ErrDigestMismatch = errors.New("chart digest mismatch")
+	//ErrProvenanceVerification is returned when the chart provenance file can not be verified with the keyring
+	ErrProvenanceVerification = errors.New("chart provenance verification failed")
+)
+
+const (
+	//KeyringSecretKey is the key of the keyring secret containing the PGP public keyring
+	KeyringSecretKey = "keyring"
+	//SSHKeySecretKey is the key of the secret containing the ssh private key for git ssh urls
+	SSHKeySecretKey = "sshKey"
+	//SSHPassphraseSecretKey is the key of the secret containing the passphrase of the ssh private key
+	SSHPassphraseSecretKey = "passphrase"
+	//SSHKnownHostsSecretKey is the key of the secret containing the known_hosts of the git ssh servers
+	SSHKnownHostsSecretKey = "knownHosts"
+)
+
 //GetHelmRepoClient returns an *http.client to access the helm repo
 func GetHelmRepoClient(parentNamespace string, configMap *corev1.ConfigMap, skipCertVerify bool) (rest.HTTPClient, error) {
 	/* #nosec G402 */
@@ -73,7 +105,7 @@ func GetHelmRepoClient(parentNamespace string, configMap *corev1.ConfigMap, skip
 		if insecureSkipVerify != "" {
 			b, err := strconv.ParseBool(insecureSkipVerify)
 			if err != nil {
-				if errors.IsNotFound(err) {
+				if apierrors.IsNotFound(err) {
 					return nil, nil
 				}
 
@@ -98,47 +130,79 @@ func GetHelmRepoClient(parentNamespace string, configMap *corev1.ConfigMap, skip
 	return httpClient, nil
 }
 
-//DownloadChart downloads the charts
+//DownloadChart downloads the charts, when keyring is not nil the chart provenance file is verified with it.
+//The commitID is only returned for git and github sources.
 func DownloadChart(configMap *corev1.ConfigMap,
 	secret *corev1.Secret,
+	keyring *corev1.Secret,
 	chartsDir string,
-	s *appv1.HelmRelease) (chartDir string, err error) {
-	destRepo := filepath.Join(chartsDir, s.Name, s.Namespace, s.Repo.ChartName)
-	if _, err := os.Stat(destRepo); os.IsNotExist(err) {
-		err := os.MkdirAll(destRepo, 0750)
-		if err != nil {
-			klog.Error(err, " - Unable to create chartDir: ", destRepo)
-			return "", err
-		}
+	s *appv1.HelmRelease) (chartDir string, commitID string, sourceURL string, err error) {
+	started := time.Now()
+
+	defer func() {
+		observeChartDownload(s.Repo.Source, started, err)
+	}()
+
+	if keyring != nil && !strings.EqualFold(string(s.Repo.Source.SourceType), string(appv1.HelmRepoSourceType)) {
+		return "", "", "", fmt.Errorf("provenance verification is not supported for sourceType '%s'", s.Repo.Source.SourceType)
 	}
 
 	switch strings.ToLower(string(s.Repo.Source.SourceType)) {
 	case string(appv1.HelmRepoSourceType):
-		return DownloadChartFromHelmRepo(configMap, secret, destRepo, s)
-	case string(appv1.GitHubSourceType):
-		return DownloadChartFromGit(configMap, secret, destRepo, s)
-	case string(appv1.GitSourceType):
-		return DownloadChartFromGit(configMap, secret, destRepo, s)
+		chartDir, sourceURL, err = downloadChartFromHelmRepo(configMap, secret, keyring, NewChartCache(chartsDir), s)
+	case string(appv1.GitHubSourceType), string(appv1.GitSourceType):
+		//The git charts are cloned in the directory of the release
+		destRepo := filepath.Join(ReleaseChartsDir(chartsDir, s), s.Repo.ChartName)
+		if err := os.MkdirAll(destRepo, 0750); err != nil {
+			klog.Error(err, " - Unable to create chartDir: ", destRepo)
+			return "", "", "", err
+		}
+
+		return downloadChartFromGit(configMap, secret, destRepo, s)
+	case string(appv1.OCISourceType):
+		chartDir, sourceURL, err = downloadChartFromOCI(configMap, secret, NewChartCache(chartsDir), s)
 	default:
-		return "", fmt.Errorf("sourceType '%s' unsupported", s.Repo.Source.SourceType)
+		return "", "", "", fmt.Errorf("sourceType '%s' unsupported", s.Repo.Source.SourceType)
 	}
+
+	return chartDir, "", sourceURL, err
+}
+
+//ReleaseChartsDir returns the directory of the chartsDir holding the charts cloned for the HelmRelease
+func ReleaseChartsDir(chartsDir string, s *appv1.HelmRelease) string {
+	return filepath.Join(chartsDir, s.Name, s.Namespace)
+}
+
+//DownloadChartFromGit downloads a chart into the charsDir and returns the commit it was taken from
+func DownloadChartFromGit(configMap *corev1.ConfigMap,
+	secret *corev1.Secret,
+	destRepo string,
+	s *appv1.HelmRelease) (chartDir string, commitID string, err error) {
+	chartDir, commitID, _, err = downloadChartFromGit(configMap, secret, destRepo, s)
+
+	return chartDir, commitID, err
 }
 
-//DownloadChartFromGit downloads a chart into the charsDir
-func DownloadChartFromGit(configMap *corev1.ConfigMap, secret *corev1.Secret, destRepo string, s *appv1.HelmRelease) (chartDir string, err error) {
+//downloadChartFromGit downloads a chart into the charsDir and returns the commit and the url it was taken from
+func downloadChartFromGit(configMap *corev1.ConfigMap,
+	secret *corev1.Secret,
+	destRepo string,
+	s *appv1.HelmRelease) (chartDir string, commitID string, gitURL string, err error) {
 	if s.Repo.Source.GitHub == nil && s.Repo.Source.Git == nil {
 		err := fmt.Errorf("git type, need Repo.Source.Git or Repo.Source.GitHub to be populated.")
-		return "", err
+		return "", "", "", err
 	}
 
 	if s.Repo.Source.GitHub != nil {
-		_, err = DownloadGitRepo(configMap, secret, destRepo, s.Repo.Source.GitHub.Urls, s.Repo.Source.GitHub.Branch)
+		commitID, gitURL, err = downloadGitRepo(configMap, secret, destRepo, s.Repo.Source.GitHub.Urls,
+			s.Repo.Source.GitHub.Branch, s.Repo.Source.GitHub.Tag, s.Repo.Source.GitHub.Commit, s.Repo.InsecureSkipVerify)
 	} else if s.Repo.Source.Git != nil {
-		_, err = DownloadGitRepo(configMap, secret, destRepo, s.Repo.Source.Git.Urls, s.Repo.Source.Git.Branch)
+		commitID, gitURL, err = downloadGitRepo(configMap, secret, destRepo, s.Repo.Source.Git.Urls,
+			s.Repo.Source.Git.Branch, s.Repo.Source.Git.Tag, s.Repo.Source.Git.Commit, s.Repo.InsecureSkipVerify)
 	}
 
 	if err != nil {
-		return "", err
+		return "", "", "", err
 	}
 
 	if s.Repo.Source.GitHub != nil {
@@ -147,14 +211,30 @@ func DownloadChartFromGit(configMap *corev1.ConfigMap, secret *corev1.Secret, de
 		chartDir = filepath.Join(destRepo, s.Repo.Source.Git.ChartPath)
 	}
 
-	return chartDir, nil
+	return chartDir, commitID, gitURL, nil
 }
 
-//DownloadGitRepo downloads a git repo into the charsDir
+//DownloadGitRepo downloads a git repo into the charsDir and returns the checked out commit.
+//The commit takes precedence over the tag and the tag over the branch, when a commit is specified
+//the history of the tag or branch is cloned to find it.
+//insecureSkipVerify disables the host key checking of ssh urls.
 func DownloadGitRepo(configMap *corev1.ConfigMap,
 	secret *corev1.Secret,
 	destRepo string,
-	urls []string, branch string) (commitID string, err error) {
+	urls []string, branch, tag, commit string,
+	insecureSkipVerify bool) (commitID string, err error) {
+	commitID, _, err = downloadGitRepo(configMap, secret, destRepo, urls, branch, tag, commit, insecureSkipVerify)
+
+	return commitID, err
+}
+
+//downloadGitRepo downloads a git repo into the charsDir and returns the checked out commit and the url it was
+//cloned from
+func downloadGitRepo(configMap *corev1.ConfigMap,
+	secret *corev1.Secret,
+	destRepo string,
+	urls []string, branch, tag, commit string,
+	insecureSkipVerify bool) (commitID string, gitURL string, err error) {
 	for _, url := range urls {
 		options := &git.CloneOptions{
 			URL:               url,
@@ -163,19 +243,35 @@ func DownloadGitRepo(configMap *corev1.ConfigMap,
 			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
 		}
 
-		if secret != nil && secret.Data != nil {
-			klog.V(5).Info("Add credentials")
+		auth, errAuth := GetGitAuth(url, secret, insecureSkipVerify)
+		if errAuth != nil {
+			klog.Error(errAuth, " - Failed to build the credentials for: ", url)
+			err = errAuth
 
-			options.Auth = &githttp.BasicAuth{
-				Username: string(secret.Data["user"]),
-				Password: GetAccessToken(secret),
-			}
+			continue
 		}
 
-		if branch == "" {
-			options.ReferenceName = plumbing.Master
-		} else {
+		options.Auth = auth
+
+		switch {
+		case tag != "":
+			options.ReferenceName = plumbing.ReferenceName("refs/tags/" + tag)
+		case branch != "":
 			options.ReferenceName = plumbing.ReferenceName("refs/heads/" + branch)
+		case commit != "":
+			//The commit can be on any branch
+			options.SingleBranch = false
+		default:
+			options.ReferenceName = plumbing.Master
+		}
+
+		if commit != "" {
+			options.Depth = 0
+		}
+
+		if localCommit, ok := isGitRepoUpToDate(destRepo, url, options.ReferenceName, commit, auth); ok {
+			klog.V(5).Info("Skip clone, ", destRepo, " is already at commit ", localCommit)
+			return localCommit, url, nil
 		}
 
 		rErr := os.RemoveAll(destRepo)
@@ -197,6 +293,21 @@ func DownloadGitRepo(configMap *corev1.ConfigMap,
 			continue
 		}
 
+		if commit != "" {
+			errCheckout := checkoutCommit(r, commit)
+			if errCheckout != nil {
+				rErr := os.RemoveAll(destRepo)
+				if rErr != nil {
+					klog.Error(err, "- Failed to remove all: ", destRepo)
+				}
+
+				klog.Error(errCheckout, " - Checkout of commit ", commit, " failed: ", url)
+				err = errCheckout
+
+				continue
+			}
+		}
+
 		h, errHead := r.Head()
 
 		if errHead != nil {
@@ -213,62 +324,432 @@ func DownloadGitRepo(configMap *corev1.ConfigMap,
 
 		commitID = h.Hash().String()
 		klog.V(5).Info("commitID: ", commitID)
+
+		return commitID, url, nil
 	}
 
 	if err != nil {
 		klog.Error(err, " - All urls failed")
 	}
 
-	return commitID, err
+	return commitID, "", err
+}
+
+//GetGitAuth returns the auth method for the git url. ssh:// and scp-like (git@host:path) urls use the
+//sshKey, passphrase and knownHosts keys of the secret, other urls use the user and accessToken keys.
+//The ssh host key is checked against knownHosts, or the default known_hosts files when it is not set,
+//unless insecureSkipVerify is true.
+func GetGitAuth(url string, secret *corev1.Secret, insecureSkipVerify bool) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoint.Protocol != "ssh" {
+		if secret == nil || secret.Data == nil {
+			return nil, nil
+		}
+
+		klog.V(5).Info("Add credentials")
+
+		return &githttp.BasicAuth{
+			Username: string(secret.Data["user"]),
+			Password: GetAccessToken(secret),
+		}, nil
+	}
+
+	if secret == nil || secret.Data == nil || len(secret.Data[SSHKeySecretKey]) == 0 {
+		return nil, fmt.Errorf("the %s key of the secret is required for ssh url %s", SSHKeySecretKey, url)
+	}
+
+	user := endpoint.User
+	if user == "" {
+		user = "git"
+	}
+
+	klog.V(5).Info("Add ssh credentials for user ", user)
+
+	auth, err := gitssh.NewPublicKeys(user, secret.Data[SSHKeySecretKey], string(secret.Data[SSHPassphraseSecretKey]))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case insecureSkipVerify:
+		klog.Info("repo.insecureSkipVerify=true. Skipping ssh host key verification for ", endpoint.Host)
+
+		auth.HostKeyCallback = ssh.InsecureIgnoreHostKey() // #nosec G106 InsecureIgnoreHostKey conditionally
+	case len(secret.Data[SSHKnownHostsSecretKey]) > 0:
+		auth.HostKeyCallback, err = knownHostsCallback(secret.Data[SSHKnownHostsSecretKey])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return auth, nil
+}
+
+//knownHostsCallback returns a host key callback checking the host keys against the known_hosts data
+func knownHostsCallback(knownHosts []byte) (ssh.HostKeyCallback, error) {
+	f, err := ioutil.TempFile("", "known_hosts")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(knownHosts)
+	closeHelper(f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	//The file is read when the callback is created
+	return knownhosts.New(f.Name())
+}
+
+//isGitRepoUpToDate returns true with the local commit when destRepo is a clone of url whose HEAD is the commit,
+//or when no commit is specified, the commit of refName on the remote. Only the remote refs are listed, an annotated
+//tag is peeled to its commit through the tag object of the clone.
+func isGitRepoUpToDate(destRepo, url string, refName plumbing.ReferenceName,
+	commit string, auth transport.AuthMethod) (string, bool) {
+	r, err := git.PlainOpen(destRepo)
+	if err != nil {
+		return "", false
+	}
+
+	origin, err := r.Remote(git.DefaultRemoteName)
+	if err != nil || len(origin.Config().URLs) == 0 || origin.Config().URLs[0] != url {
+		return "", false
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return "", false
+	}
+
+	localCommit := head.Hash().String()
+
+	if commit != "" {
+		return localCommit, strings.HasPrefix(localCommit, strings.ToLower(commit))
+	}
+
+	if refName == "" {
+		return "", false
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{url},
+	})
+
+	refs, err := remote.List(&git.ListOptions{Auth: auth})
+	if err != nil {
+		klog.Error(err, " - Failed to list the refs of: ", url)
+		return "", false
+	}
+
+	for _, ref := range refs {
+		if ref.Name() == refName {
+			return localCommit, peelTag(r, ref.Hash()) == head.Hash()
+		}
+	}
+
+	return "", false
+}
+
+//peelTag returns the commit of the annotated tag object of the hash, or the hash when it is not a tag object of
+//the repository
+func peelTag(r *git.Repository, hash plumbing.Hash) plumbing.Hash {
+	tag, err := r.TagObject(hash)
+	if err != nil {
+		return hash
+	}
+
+	c, err := tag.Commit()
+	if err != nil {
+		return hash
+	}
+
+	return c.Hash
+}
+
+//checkoutCommit checks out the commit, which can be abbreviated, in a detached HEAD
+func checkoutCommit(r *git.Repository, commit string) error {
+	hash, err := resolveCommit(r, commit)
+	if err != nil {
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return w.Checkout(&git.CheckoutOptions{Hash: hash, Force: true})
+}
+
+//resolveCommit returns the hash of the commit of the repository, an abbreviated commit is resolved by walking
+//the commits of the repository and must match a single one
+func resolveCommit(r *git.Repository, commit string) (plumbing.Hash, error) {
+	prefix := strings.ToLower(commit)
+
+	if len(prefix) == len(plumbing.ZeroHash.String()) {
+		c, err := r.CommitObject(plumbing.NewHash(prefix))
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("commit %s not found: %w", commit, err)
+		}
+
+		return c.Hash, nil
+	}
+
+	commits, err := r.CommitObjects()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	defer commits.Close()
+
+	var matches []plumbing.Hash
+
+	err = commits.ForEach(func(c *object.Commit) error {
+		if strings.HasPrefix(c.Hash.String(), prefix) {
+			matches = append(matches, c.Hash)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	switch len(matches) {
+	case 0:
+		return plumbing.ZeroHash, fmt.Errorf("commit %s not found", commit)
+	case 1:
+		return matches[0], nil
+	default:
+		return plumbing.ZeroHash, fmt.Errorf("commit %s is ambiguous, it matches %d commits", commit, len(matches))
+	}
 }
 
-//DownloadChartFromHelmRepo downloads a chart into the chartDir
+//DownloadChartFromHelmRepo downloads a chart into the chart cache and returns the chart directory it is expanded in
 func DownloadChartFromHelmRepo(configMap *corev1.ConfigMap,
 	secret *corev1.Secret,
-	destRepo string,
+	keyring *corev1.Secret,
+	cache *ChartCache,
 	s *appv1.HelmRelease) (chartDir string, err error) {
+	chartDir, _, err = downloadChartFromHelmRepo(configMap, secret, keyring, cache, s)
+
+	return chartDir, err
+}
+
+//downloadChartFromHelmRepo downloads a chart into the chart cache and returns the chart directory it is expanded in
+//and the url of the chart archive
+func downloadChartFromHelmRepo(configMap *corev1.ConfigMap,
+	secret *corev1.Secret,
+	keyring *corev1.Secret,
+	cache *ChartCache,
+	s *appv1.HelmRelease) (chartDir string, chartURL string, err error) {
 	if s.Repo.Source.HelmRepo == nil {
 		err := fmt.Errorf("helmrepo type but Spec.HelmRepo is not defined")
-		return "", err
+		return "", "", err
 	}
 
 	var urlsError string
 
+	var verificationErr error
+
 	for _, url := range s.Repo.Source.HelmRepo.Urls {
-		chartDir, err := downloadChartFromURL(configMap, secret, destRepo, s, url)
+		chartURL := url
+		version := s.Repo.Version
+		digest := s.Repo.Digest
+
+		if !IsChartArchiveURL(url) {
+			chartVersion, err := GetChartVersionFromIndex(configMap, secret, cache, s, url)
+			if err != nil {
+				urlsError += " - url: " + url + " error: " + err.Error()
+				continue
+			}
+
+			chartURL, err = resolveChartVersionURL(url, chartVersion)
+			if err != nil {
+				urlsError += " - url: " + url + " error: " + err.Error()
+				continue
+			}
+
+			version = chartVersion.Version
+
+			if digest == "" {
+				digest = chartVersion.Digest
+			}
+		}
+
+		chartDir, err := downloadChartFromURL(configMap, secret, keyring, cache, s, chartURL, version, digest)
 		if err == nil {
-			return chartDir, nil
+			return chartDir, chartURL, nil
+		}
+
+		switch {
+		case errors.Is(err, ErrDigestMismatch):
+			verificationErr = ErrDigestMismatch
+		case errors.Is(err, ErrProvenanceVerification):
+			verificationErr = ErrProvenanceVerification
 		}
 
-		urlsError += " - url: " + url + " error: " + err.Error()
+		urlsError += " - url: " + chartURL + " error: " + err.Error()
+	}
+
+	if verificationErr != nil {
+		return "", "", fmt.Errorf("%w, failed to download chart from helm repo. %s", verificationErr, urlsError)
+	}
+
+	return "", "", fmt.Errorf("failed to download chart from helm repo. " + urlsError)
+}
+
+//IsChartArchiveURL returns true if the url points directly to a chart archive instead of a helm repo
+func IsChartArchiveURL(chartURL string) bool {
+	chartURL = strings.TrimSuffix(strings.TrimSpace(chartURL), "/")
+
+	if u, err := url.Parse(chartURL); err == nil {
+		if u.Opaque != "" {
+			chartURL = u.Opaque
+		} else {
+			chartURL = u.Path
+		}
+	}
+
+	return strings.HasSuffix(chartURL, ".tgz") || strings.HasSuffix(chartURL, ".tar.gz")
+}
+
+//GetChartVersionFromIndex returns the entry of the index.yaml of the helm repo matching Repo.ChartName and
+//Repo.Version, the index is downloaded again once older than the IndexTTL of the cache
+func GetChartVersionFromIndex(configMap *corev1.ConfigMap,
+	secret *corev1.Secret,
+	cache *ChartCache,
+	s *appv1.HelmRelease,
+	repoURL string) (*repo.ChartVersion, error) {
+	if s.Repo.ChartName == "" {
+		return nil, fmt.Errorf("chartName is required to look up the chart in the helm repo index %s", repoURL)
+	}
+
+	indexURL := strings.TrimSuffix(repoURL, "/") + "/index.yaml"
+
+	indexFile, err := cache.FetchIndex(indexURL, secret, func(entryDir string) (string, error) {
+		return downloadFile(s.Namespace, configMap, indexURL, secret, entryDir, s.Repo.InsecureSkipVerify)
+	})
+	if err != nil {
+		klog.Error(err, " - Failed to download the helm repo index: ", indexURL)
+		return nil, err
+	}
+
+	index, err := repo.LoadIndexFile(indexFile)
+	if err != nil {
+		//Evict the index so it gets downloaded again on the next attempt
+		cache.RemoveIndex(indexURL, secret)
+
+		klog.Error(err, " - Failed to load the helm repo index: ", indexURL)
+
+		return nil, err
+	}
+
+	chartVersion, err := index.Get(s.Repo.ChartName, s.Repo.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find chart %s version %q in %s: %w", s.Repo.ChartName, s.Repo.Version, indexURL, err)
+	}
+
+	if len(chartVersion.URLs) == 0 {
+		return nil, fmt.Errorf("chart %s version %s has no urls in %s", s.Repo.ChartName, chartVersion.Version, indexURL)
+	}
+
+	klog.V(3).Info("Found chart ", s.Repo.ChartName, " version ", chartVersion.Version, " in ", indexURL)
+
+	return chartVersion, nil
+}
+
+//IsVersionConstraint returns true if the version is a semver range (e.g. ~1.4 or >=2.0.0 <3.0.0)
+//rather than a single chart version
+func IsVersionConstraint(version string) bool {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return false
+	}
+
+	if _, err := semver.StrictNewVersion(version); err == nil {
+		return false
 	}
 
-	return "", fmt.Errorf("failed to download chart from helm repo. " + urlsError)
+	_, err := semver.NewConstraint(version)
+
+	return err == nil
+}
+
+//resolveChartVersionURL returns the absolute url of the chart archive, index entries can be relative to the repo url
+func resolveChartVersionURL(repoURL string, chartVersion *repo.ChartVersion) (string, error) {
+	chartURL := chartVersion.URLs[0]
+
+	u, err := url.Parse(chartURL)
+	if err != nil {
+		return "", err
+	}
+
+	if u.IsAbs() {
+		return chartURL, nil
+	}
+
+	return strings.TrimSuffix(repoURL, "/") + "/" + strings.TrimPrefix(chartURL, "/"), nil
 }
 
 func downloadChartFromURL(configMap *corev1.ConfigMap,
 	secret *corev1.Secret,
-	destRepo string,
+	keyring *corev1.Secret,
+	cache *ChartCache,
 	s *appv1.HelmRelease,
-	url string) (chartDir string, err error) {
-	chartZip, downloadErr := downloadFile(s.Namespace, configMap, url, secret, destRepo, s.Repo.InsecureSkipVerify)
-	if downloadErr != nil {
-		klog.Error(downloadErr, " - url: ", url)
-		return "", downloadErr
+	url string,
+	version string,
+	digest string) (chartDir string, err error) {
+	key := ChartCacheKey(url, version, digest, secret)
+
+	chartZip, err := cache.Fetch(key, digest, func(entryDir string) (string, error) {
+		return downloadFile(s.Namespace, configMap, url, secret, entryDir, s.Repo.InsecureSkipVerify)
+	})
+	if err != nil {
+		klog.Error(err, " - url: ", url)
+		return "", err
 	}
 
-	r, downloadErr := os.Open(filepath.Clean(chartZip))
-	if downloadErr != nil {
-		klog.Error(downloadErr, " - Failed to open: ", chartZip, " using url: ", url)
-		return "", downloadErr
+	if keyring != nil {
+		err = verifyProvenance(configMap, secret, keyring, chartZip, s, url)
+		if err != nil {
+			//Evict the chart and its provenance file so they get downloaded again on the next attempt
+			cache.Remove(key)
+
+			klog.Error(err, " - url: ", url)
+
+			return "", err
+		}
+	}
+
+	return cache.Expand(key, chartZip, s.Repo.ChartName)
+}
+
+//expandChart untars the chart archive into destRepo and returns the chart directory
+func expandChart(chartZip, destRepo, chartName string) (chartDir string, err error) {
+	r, err := os.Open(filepath.Clean(chartZip))
+	if err != nil {
+		klog.Error(err, " - Failed to open: ", chartZip)
+		return "", err
 	}
 
-	chartDir = filepath.Join(destRepo, s.Repo.ChartName)
+	defer closeHelper(r)
+
+	chartDir = filepath.Join(destRepo, chartName)
 	chartDir = filepath.Clean(chartDir)
 	//Clean before untar
 	err = os.RemoveAll(chartDir)
 	if err != nil {
-		klog.Error(err, "- Failed to remove all: ", chartDir, " for ", chartZip, " using url: ", url)
+		klog.Error(err, "- Failed to remove all: ", chartDir, " for ", chartZip)
 	}
 
 	//Untar
@@ -280,7 +761,7 @@ func downloadChartFromURL(configMap *corev1.ConfigMap,
 			klog.Error(rErr, "- Failed to remove all: ", chartZip)
 		}
 
-		klog.Error(err, "- Failed to unzip: ", chartZip, " using url: ", url)
+		klog.Error(err, "- Failed to unzip: ", chartZip)
 
 		return "", err
 	}
@@ -288,6 +769,81 @@ func downloadChartFromURL(configMap *corev1.ConfigMap,
 	return chartDir, nil
 }
 
+//VerifyDigest checks the sha256 digest of the file against the expected digest,
+//the expected digest can be prefixed with "sha256:" like in OCI registries
+func VerifyDigest(file, expected string) error {
+	expected = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(expected), "sha256:"))
+
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return err
+	}
+
+	defer closeHelper(f)
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if actual != expected {
+		return fmt.Errorf("%w: expected sha256 %s but %s has %s", ErrDigestMismatch, expected, filepath.Base(file), actual)
+	}
+
+	klog.V(3).Info("Digest verified for ", file, ": ", actual)
+
+	return nil
+}
+
+//verifyProvenance downloads the chart provenance file (<chart url>.prov) and verifies it with the keyring
+func verifyProvenance(configMap *corev1.ConfigMap,
+	secret *corev1.Secret,
+	keyring *corev1.Secret,
+	chartZip string,
+	s *appv1.HelmRelease,
+	url string) error {
+	if len(keyring.Data[KeyringSecretKey]) == 0 {
+		return fmt.Errorf("%w: secret %s/%s has no %s key", ErrProvenanceVerification,
+			keyring.Namespace, keyring.Name, KeyringSecretKey)
+	}
+
+	provFile, err := downloadFile(s.Namespace, configMap, url+".prov", secret, filepath.Dir(chartZip), s.Repo.InsecureSkipVerify)
+	if err != nil {
+		return fmt.Errorf("%w: failed to download the provenance file: %v", ErrProvenanceVerification, err)
+	}
+
+	if provFile != chartZip+".prov" {
+		return fmt.Errorf("%w: unexpected provenance file %s for %s", ErrProvenanceVerification, provFile, chartZip)
+	}
+
+	keyringFile, err := ioutil.TempFile("", "keyring")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(keyringFile.Name())
+
+	_, err = keyringFile.Write(keyring.Data[KeyringSecretKey])
+	closeHelper(keyringFile)
+
+	if err != nil {
+		return err
+	}
+
+	verification, err := downloader.VerifyChart(chartZip, keyringFile.Name())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrProvenanceVerification, err)
+	}
+
+	for name := range verification.SignedBy.Identities {
+		klog.Info("Chart ", filepath.Base(chartZip), " signed by ", name, " using key ",
+			verification.SignedBy.PrimaryKey.KeyIdString(), " is verified")
+	}
+
+	return nil
+}
+
 //downloadFile downloads a files and post it in the chartsDir.
 func downloadFile(parentNamespace string, configMap *corev1.ConfigMap,
 	fileURL string,
@@ -358,70 +914,59 @@ func downloadFileHTTP(parentNamespace string, configMap *corev1.ConfigMap,
 	secret *corev1.Secret,
 	chartZip string,
 	insecureSkipVerify bool) error {
-	fileInfo, err := os.Stat(chartZip)
-	if fileInfo != nil && fileInfo.IsDir() {
+	if fileInfo, err := os.Stat(chartZip); err == nil && fileInfo.IsDir() {
 		downloadErr := fmt.Errorf("expecting chartZip to be a file but it's a directory: %s", chartZip)
 		klog.Error(downloadErr)
 
 		return downloadErr
 	}
 
-	if os.IsNotExist(err) {
-		httpClient, downloadErr := GetHelmRepoClient(parentNamespace, configMap, insecureSkipVerify)
-		if downloadErr != nil {
-			klog.Error(downloadErr, " - Failed to create httpClient")
-			return downloadErr
-		}
-
-		var req *http.Request
-
-		req, downloadErr = http.NewRequest(http.MethodGet, fileURL, nil)
-		if downloadErr != nil {
-			klog.Error(downloadErr, "- Can not build request: ", "fileURL", fileURL)
-			return downloadErr
-		}
-
-		if secret != nil && secret.Data != nil {
-			req.SetBasicAuth(string(secret.Data["user"]), GetPassword(secret))
-		}
+	httpClient, err := GetHelmRepoClient(parentNamespace, configMap, insecureSkipVerify)
+	if err != nil {
+		klog.Error(err, " - Failed to create httpClient")
+		return err
+	}
 
-		var resp *http.Response
+	req, err := http.NewRequest(http.MethodGet, fileURL, nil)
+	if err != nil {
+		klog.Error(err, "- Can not build request: ", "fileURL", fileURL)
+		return err
+	}
 
-		resp, downloadErr = httpClient.Do(req)
-		if downloadErr != nil {
-			klog.Error(downloadErr, "- Http request failed: ", "fileURL", fileURL)
-			return downloadErr
-		}
+	if secret != nil && secret.Data != nil {
+		req.SetBasicAuth(string(secret.Data["user"]), GetPassword(secret))
+	}
 
-		if resp.StatusCode != 200 {
-			downloadErr = fmt.Errorf("return code: %d unable to retrieve chart", resp.StatusCode)
-			klog.Error(downloadErr, " - Unable to retrieve chart")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		klog.Error(err, "- Http request failed: ", "fileURL", fileURL)
+		return err
+	}
 
-			return downloadErr
-		}
+	defer closeHelper(resp.Body)
 
-		klog.V(5).Info("Download chart form helmrepo succeeded: ", fileURL)
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("return code: %d unable to retrieve chart", resp.StatusCode)
+		klog.Error(err, " - Unable to retrieve chart")
 
-		defer resp.Body.Close()
+		return err
+	}
 
-		var out *os.File
+	klog.V(5).Info("Download chart form helmrepo succeeded: ", fileURL)
 
-		out, downloadErr = os.Create(chartZip)
-		if downloadErr != nil {
-			klog.Error(downloadErr, " - Failed to create: ", chartZip)
-			return downloadErr
-		}
+	out, err := os.Create(chartZip)
+	if err != nil {
+		klog.Error(err, " - Failed to create: ", chartZip)
+		return err
+	}
 
-		defer closeHelper(out)
+	defer closeHelper(out)
 
-		// Write the body to file
-		_, downloadErr = io.Copy(out, resp.Body)
-		if downloadErr != nil {
-			klog.Error(downloadErr, " - Failed to copy body:", chartZip)
-			return downloadErr
-		}
-	} else {
-		klog.V(5).Info("Skip download chartZip already exists: ", chartZip)
+	// Write the body to file
+	_, err = io.Copy(out, resp.Body)
+	if err != nil {
+		klog.Error(err, " - Failed to copy body:", chartZip)
+		return err
 	}
 
 	return nil
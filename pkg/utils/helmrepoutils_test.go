@@ -17,15 +17,35 @@ limitations under the License.
 package utils
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/onsi/gomega"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/repo"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -163,7 +183,7 @@ func TestDownloadChartGitHub(t *testing.T) {
 
 	defer os.RemoveAll(dir)
 
-	destDir, err := DownloadChart(nil, nil, dir, hr)
+	destDir, _, _, err := DownloadChart(nil, nil, nil, dir, hr)
 	assert.NoError(t, err)
 
 	_, err = os.Stat(filepath.Join(destDir, "Chart.yaml"))
@@ -193,7 +213,7 @@ func TestDownloadChartGit(t *testing.T) {
 
 	defer os.RemoveAll(dir)
 
-	destDir, err := DownloadChart(nil, nil, dir, hr)
+	destDir, _, _, err := DownloadChart(nil, nil, nil, dir, hr)
 	assert.NoError(t, err)
 
 	_, err = os.Stat(filepath.Join(destDir, "Chart.yaml"))
@@ -222,7 +242,7 @@ func TestDownloadChartHelmRepo(t *testing.T) {
 
 	defer os.RemoveAll(dir)
 
-	destDir, err := DownloadChart(nil, nil, dir, hr)
+	destDir, _, _, err := DownloadChart(nil, nil, nil, dir, hr)
 	assert.NoError(t, err)
 
 	_, err = os.Stat(filepath.Join(destDir, "Chart.yaml"))
@@ -252,7 +272,7 @@ func TestDownloadChartHelmRepoContainsInvalidURL(t *testing.T) {
 
 	defer os.RemoveAll(dir)
 
-	destDir, err := DownloadChart(nil, nil, dir, hr)
+	destDir, _, _, err := DownloadChart(nil, nil, nil, dir, hr)
 	assert.NoError(t, err)
 
 	_, err = os.Stat(filepath.Join(destDir, "Chart.yaml"))
@@ -281,7 +301,7 @@ func TestDownloadChartHelmRepoContainsInvalidURL2(t *testing.T) {
 
 	defer os.RemoveAll(dir)
 
-	destDir, err := DownloadChart(nil, nil, dir, hr)
+	destDir, _, _, err := DownloadChart(nil, nil, nil, dir, hr)
 	assert.NoError(t, err)
 
 	_, err = os.Stat(filepath.Join(destDir, "Chart.yaml"))
@@ -309,7 +329,7 @@ func TestDownloadChartHelmRepoAllInvalidURLs(t *testing.T) {
 
 	defer os.RemoveAll(dir)
 
-	_, err = DownloadChart(nil, nil, dir, hr)
+	_, _, _, err = DownloadChart(nil, nil, nil, dir, hr)
 	assert.Error(t, err)
 }
 
@@ -336,7 +356,7 @@ func TestDownloadChartFromGitHub(t *testing.T) {
 
 	defer os.RemoveAll(dir)
 
-	destDir, err := DownloadChartFromGit(nil, nil, dir, hr)
+	destDir, _, err := DownloadChartFromGit(nil, nil, dir, hr)
 	assert.NoError(t, err)
 
 	_, err = os.Stat(filepath.Join(destDir, "Chart.yaml"))
@@ -366,7 +386,7 @@ func TestDownloadChartFromGit(t *testing.T) {
 
 	defer os.RemoveAll(dir)
 
-	destDir, err := DownloadChartFromGit(nil, nil, dir, hr)
+	destDir, _, err := DownloadChartFromGit(nil, nil, dir, hr)
 	assert.NoError(t, err)
 
 	_, err = os.Stat(filepath.Join(destDir, "Chart.yaml"))
@@ -395,7 +415,7 @@ func TestDownloadChartFromHelmRepoHTTP(t *testing.T) {
 
 	defer os.RemoveAll(dir)
 
-	chartDir, err := DownloadChartFromHelmRepo(nil, nil, dir, hr)
+	chartDir, err := DownloadChartFromHelmRepo(nil, nil, nil, NewChartCache(dir), hr)
 	assert.NoError(t, err)
 
 	_, err = os.Stat(filepath.Join(chartDir, "Chart.yaml"))
@@ -423,7 +443,7 @@ func TestDownloadChartFromHelmRepoLocal(t *testing.T) {
 
 	defer os.RemoveAll(dir)
 
-	chartDir, err := DownloadChartFromHelmRepo(nil, nil, dir, hr)
+	chartDir, err := DownloadChartFromHelmRepo(nil, nil, nil, NewChartCache(dir), hr)
 	assert.NoError(t, err)
 
 	_, err = os.Stat(filepath.Join(chartDir, "Chart.yaml"))
@@ -438,7 +458,7 @@ func TestDownloadGitRepo(t *testing.T) {
 
 	destRepo := filepath.Join(dir, "test")
 	commitID, err := DownloadGitRepo(nil, nil, destRepo,
-		[]string{"https://github.com/open-cluster-management/multicloud-operators-subscription-release.git"}, "main")
+		[]string{"https://github.com/open-cluster-management/multicloud-operators-subscription-release.git"}, "main", "", "", false)
 	assert.NoError(t, err)
 
 	_, err = os.Stat(filepath.Join(destRepo, "OWNERS"))
@@ -446,3 +466,527 @@ func TestDownloadGitRepo(t *testing.T) {
 
 	assert.NotEqual(t, commitID, "")
 }
+
+//newTestGitRepo creates a git repo with two commits on master, the first one tagged v1
+func newTestGitRepo(t *testing.T) (repoDir string, first, second plumbing.Hash) {
+	repoDir, err := ioutil.TempDir("/tmp", "gitrepo")
+	assert.NoError(t, err)
+
+	r, err := git.PlainInit(repoDir, false)
+	assert.NoError(t, err)
+
+	w, err := r.Worktree()
+	assert.NoError(t, err)
+
+	commit := func(content string) plumbing.Hash {
+		err := ioutil.WriteFile(filepath.Join(repoDir, "version"), []byte(content), 0600)
+		assert.NoError(t, err)
+
+		_, err = w.Add("version")
+		assert.NoError(t, err)
+
+		h, err := w.Commit(content, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		assert.NoError(t, err)
+
+		return h
+	}
+
+	first = commit("v1")
+
+	_, err = r.CreateTag("v1", first, nil)
+	assert.NoError(t, err)
+
+	second = commit("v2")
+
+	_, err = r.CreateTag("v2", second, &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		Message: "v2",
+	})
+	assert.NoError(t, err)
+
+	return repoDir, first, second
+}
+
+func TestDownloadGitRepoTagAndCommit(t *testing.T) {
+	repoDir, first, second := newTestGitRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	destRepo := filepath.Join(dir, "test")
+
+	commitID, err := DownloadGitRepo(nil, nil, destRepo, []string{"file://" + repoDir}, "", "", "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, second.String(), commitID)
+
+	commitID, err = DownloadGitRepo(nil, nil, destRepo, []string{"file://" + repoDir}, "", "v1", "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, first.String(), commitID)
+
+	content, err := ioutil.ReadFile(filepath.Join(destRepo, "version"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(content))
+
+	commitID, err = DownloadGitRepo(nil, nil, destRepo, []string{"file://" + repoDir}, "master", "", first.String(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, first.String(), commitID)
+
+	content, err = ioutil.ReadFile(filepath.Join(destRepo, "version"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(content))
+
+	// an abbreviated commit is resolved against the commits of the clone
+	commitID, err = DownloadGitRepo(nil, nil, destRepo, []string{"file://" + repoDir}, "", "",
+		strings.ToUpper(second.String()[:7]), false)
+	assert.NoError(t, err)
+	assert.Equal(t, second.String(), commitID)
+
+	content, err = ioutil.ReadFile(filepath.Join(destRepo, "version"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(content))
+
+	_, err = DownloadGitRepo(nil, nil, destRepo, []string{"file://" + repoDir}, "", "",
+		"0000000000000000000000000000000000000000", false)
+	assert.Error(t, err)
+
+	_, err = DownloadGitRepo(nil, nil, destRepo, []string{"file://" + repoDir}, "", "", "00000000", false)
+	assert.Error(t, err)
+}
+
+func TestDownloadGitRepoUpToDate(t *testing.T) {
+	repoDir, _, second := newTestGitRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	destRepo := filepath.Join(dir, "test")
+
+	commitID, err := DownloadGitRepo(nil, nil, destRepo, []string{"file://" + repoDir}, "master", "", "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, second.String(), commitID)
+
+	// the marker is kept as long as the clone is not replaced
+	marker := filepath.Join(destRepo, "marker")
+	err = ioutil.WriteFile(marker, []byte("marker"), 0600)
+	assert.NoError(t, err)
+
+	commitID, err = DownloadGitRepo(nil, nil, destRepo, []string{"file://" + repoDir}, "master", "", "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, second.String(), commitID)
+
+	_, err = os.Stat(marker)
+	assert.NoError(t, err)
+
+	r, err := git.PlainOpen(repoDir)
+	assert.NoError(t, err)
+
+	w, err := r.Worktree()
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(repoDir, "version"), []byte("v3"), 0600)
+	assert.NoError(t, err)
+
+	_, err = w.Add("version")
+	assert.NoError(t, err)
+
+	third, err := w.Commit("v3", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	assert.NoError(t, err)
+
+	commitID, err = DownloadGitRepo(nil, nil, destRepo, []string{"file://" + repoDir}, "master", "", "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, third.String(), commitID)
+
+	_, err = os.Stat(marker)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadGitRepoAnnotatedTag(t *testing.T) {
+	repoDir, _, second := newTestGitRepo(t)
+	defer os.RemoveAll(repoDir)
+
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	destRepo := filepath.Join(dir, "test")
+
+	commitID, err := DownloadGitRepo(nil, nil, destRepo, []string{"file://" + repoDir}, "", "v2", "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, second.String(), commitID)
+
+	// the annotated tag is peeled to its commit, the clone is not replaced
+	marker := filepath.Join(destRepo, "marker")
+	err = ioutil.WriteFile(marker, []byte("marker"), 0600)
+	assert.NoError(t, err)
+
+	commitID, err = DownloadGitRepo(nil, nil, destRepo, []string{"file://" + repoDir}, "", "v2", "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, second.String(), commitID)
+
+	_, err = os.Stat(marker)
+	assert.NoError(t, err)
+}
+
+func TestGetGitAuth(t *testing.T) {
+	auth, err := GetGitAuth("https://github.com/open-cluster-management/multicloud-operators-subscription-release.git", nil, false)
+	assert.NoError(t, err)
+	assert.Nil(t, auth)
+
+	secret := &corev1.Secret{
+		Data: map[string][]byte{
+			"user":        []byte("user"),
+			"accessToken": []byte("token"),
+		},
+	}
+
+	auth, err = GetGitAuth("https://github.com/open-cluster-management/multicloud-operators-subscription-release.git", secret, false)
+	assert.NoError(t, err)
+	assert.Equal(t, &githttp.BasicAuth{Username: "user", Password: "token"}, auth)
+
+	_, err = GetGitAuth("git@github.com:open-cluster-management/multicloud-operators-subscription-release.git", secret, false)
+	assert.Error(t, err)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.NoError(t, err)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	otherSigner, err := ssh.NewSignerFromKey(otherKey)
+	assert.NoError(t, err)
+
+	secret.Data[SSHKeySecretKey] = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	secret.Data[SSHKnownHostsSecretKey] = []byte(knownhosts.Line([]string{"git.example.com"}, signer.PublicKey()))
+
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+
+	for _, url := range []string{"git@git.example.com:org/charts.git", "ssh://git@git.example.com/org/charts.git"} {
+		auth, err = GetGitAuth(url, secret, false)
+		assert.NoError(t, err)
+
+		publicKeys, ok := auth.(*gitssh.PublicKeys)
+		assert.True(t, ok)
+		assert.Equal(t, "git", publicKeys.User)
+
+		config, err := publicKeys.ClientConfig()
+		assert.NoError(t, err)
+
+		assert.NoError(t, config.HostKeyCallback("git.example.com:22", addr, signer.PublicKey()))
+		assert.Error(t, config.HostKeyCallback("git.example.com:22", addr, otherSigner.PublicKey()))
+		assert.Error(t, config.HostKeyCallback("other.example.com:22", addr, signer.PublicKey()))
+	}
+
+	auth, err = GetGitAuth("ssh://git@git.example.com/org/charts.git", secret, true)
+	assert.NoError(t, err)
+
+	config, err := auth.(*gitssh.PublicKeys).ClientConfig()
+	assert.NoError(t, err)
+	assert.NoError(t, config.HostKeyCallback("other.example.com:22", addr, otherSigner.PublicKey()))
+}
+
+func newTestHelmRepoDir(t *testing.T) string {
+	repoDir, err := ioutil.TempDir("/tmp", "helmrepo")
+	assert.NoError(t, err)
+
+	chartZip, err := ioutil.ReadFile("../../test/helmrepo/subscription-release-test-1-0.1.0.tgz")
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(repoDir, "subscription-release-test-1-0.1.0.tgz"), chartZip, 0600)
+	assert.NoError(t, err)
+
+	index, err := repo.IndexDirectory(repoDir, "")
+	assert.NoError(t, err)
+
+	err = index.WriteFile(filepath.Join(repoDir, "index.yaml"), 0600)
+	assert.NoError(t, err)
+
+	return repoDir
+}
+
+func TestDownloadChartFromHelmRepoIndex(t *testing.T) {
+	repoDir := newTestHelmRepoDir(t)
+	defer os.RemoveAll(repoDir)
+
+	server := httptest.NewServer(http.FileServer(http.Dir(repoDir)))
+	defer server.Close()
+
+	hr := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "subscription-release-test-1-cr",
+			Namespace: "default",
+		},
+		Repo: appv1.HelmReleaseRepo{
+			Source: &appv1.Source{
+				SourceType: appv1.HelmRepoSourceType,
+				HelmRepo: &appv1.HelmRepo{
+					Urls: []string{server.URL},
+				},
+			},
+			ChartName: "subscription-release-test-1",
+			Version:   "0.1.0",
+		},
+	}
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	chartDir, err := DownloadChartFromHelmRepo(nil, nil, nil, NewChartCache(dir), hr)
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(chartDir, "Chart.yaml"))
+	assert.NoError(t, err)
+
+	hr.Repo.Version = "~0.1"
+
+	chartDir, err = DownloadChartFromHelmRepo(nil, nil, nil, NewChartCache(dir), hr)
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(chartDir, "Chart.yaml"))
+	assert.NoError(t, err)
+
+	hr.Repo.Version = "9.9.9"
+
+	_, err = DownloadChartFromHelmRepo(nil, nil, nil, NewChartCache(dir), hr)
+	assert.Error(t, err)
+}
+
+func TestDownloadFileHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write([]byte("apiVersion: v1\n"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	// an existing file is downloaded again
+	indexFile := filepath.Join(dir, "index.yaml")
+	assert.NoError(t, ioutil.WriteFile(indexFile, []byte("stale"), 0600))
+
+	assert.NoError(t, downloadFileHTTP("default", nil, server.URL+"/index.yaml", nil, indexFile, false))
+
+	content, err := ioutil.ReadFile(indexFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "apiVersion: v1\n", string(content))
+
+	assert.Error(t, downloadFileHTTP("default", nil, server.URL+"/missing.yaml", nil,
+		filepath.Join(dir, "missing.yaml"), false))
+}
+
+func TestDownloadChartFromHelmRepoIndexLocal(t *testing.T) {
+	repoDir := newTestHelmRepoDir(t)
+	defer os.RemoveAll(repoDir)
+
+	hr := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "subscription-release-test-1-cr",
+			Namespace: "default",
+		},
+		Repo: appv1.HelmReleaseRepo{
+			Source: &appv1.Source{
+				SourceType: appv1.HelmRepoSourceType,
+				HelmRepo: &appv1.HelmRepo{
+					Urls: []string{"file:" + repoDir},
+				},
+			},
+			ChartName: "subscription-release-test-1",
+		},
+	}
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	chartDir, err := DownloadChartFromHelmRepo(nil, nil, nil, NewChartCache(dir), hr)
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(chartDir, "Chart.yaml"))
+	assert.NoError(t, err)
+}
+
+func TestIsChartArchiveURL(t *testing.T) {
+	assert.True(t, IsChartArchiveURL("https://charts.example.com/nginx-0.1.0.tgz"))
+	assert.True(t, IsChartArchiveURL("file:../../test/helmrepo/nginx-chart-0.1.0.tgz"))
+	assert.True(t, IsChartArchiveURL("https://charts.example.com/nginx-0.1.0.tar.gz?token=abc"))
+	assert.False(t, IsChartArchiveURL("https://charts.example.com"))
+	assert.False(t, IsChartArchiveURL("https://charts.example.com/stable/"))
+}
+
+func TestIsVersionConstraint(t *testing.T) {
+	assert.False(t, IsVersionConstraint(""))
+	assert.False(t, IsVersionConstraint("1.4.2"))
+	assert.False(t, IsVersionConstraint("1.4.2-rc.1"))
+	assert.True(t, IsVersionConstraint("~1.4"))
+	assert.True(t, IsVersionConstraint(">=2.0.0 <3.0.0"))
+	assert.True(t, IsVersionConstraint("1.x"))
+	assert.False(t, IsVersionConstraint("not a version"))
+}
+
+func TestDownloadChartFromHelmRepoDigest(t *testing.T) {
+	hr := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "subscription-release-test-1-cr",
+			Namespace: "default",
+		},
+		Repo: appv1.HelmReleaseRepo{
+			Source: &appv1.Source{
+				SourceType: appv1.HelmRepoSourceType,
+				HelmRepo: &appv1.HelmRepo{
+					Urls: []string{"file:../../test/helmrepo/subscription-release-test-1-0.1.0.tgz"},
+				},
+			},
+			ChartName: "subscription-release-test-1",
+			Digest:    "2b9ada622755a18b6b9ab72e942f819bf7c2ba7362f15d8e8bf8056429f38769",
+		},
+	}
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	chartDir, err := DownloadChartFromHelmRepo(nil, nil, nil, NewChartCache(dir), hr)
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(chartDir, "Chart.yaml"))
+	assert.NoError(t, err)
+
+	hr.Repo.Digest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+	_, err = DownloadChartFromHelmRepo(nil, nil, nil, NewChartCache(dir), hr)
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, ErrDigestMismatch))
+
+	// the mismatching chart is evicted
+	_, err = os.Stat(filepath.Join(dir, "subscription-release-test-1-0.1.0.tgz"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadChartFromHelmRepoIndexDigest(t *testing.T) {
+	repoDir := newTestHelmRepoDir(t)
+	defer os.RemoveAll(repoDir)
+
+	// corrupt the chart after it has been indexed
+	err := ioutil.WriteFile(filepath.Join(repoDir, "subscription-release-test-1-0.1.0.tgz"), []byte("corrupted"), 0600)
+	assert.NoError(t, err)
+
+	hr := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "subscription-release-test-1-cr",
+			Namespace: "default",
+		},
+		Repo: appv1.HelmReleaseRepo{
+			Source: &appv1.Source{
+				SourceType: appv1.HelmRepoSourceType,
+				HelmRepo: &appv1.HelmRepo{
+					Urls: []string{"file:" + repoDir},
+				},
+			},
+			ChartName: "subscription-release-test-1",
+			Version:   "0.1.0",
+		},
+	}
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	_, err = DownloadChartFromHelmRepo(nil, nil, nil, NewChartCache(dir), hr)
+	assert.True(t, errors.Is(err, ErrDigestMismatch))
+}
+
+func TestDownloadChartFromHelmRepoProvenance(t *testing.T) {
+	repoDir := newTestHelmRepoDir(t)
+	defer os.RemoveAll(repoDir)
+
+	signer, err := openpgp.NewEntity("helmrelease", "test", "helmrelease@example.com", nil)
+	assert.NoError(t, err)
+
+	chartZip := filepath.Join(repoDir, "subscription-release-test-1-0.1.0.tgz")
+	signatory := &provenance.Signatory{Entity: signer, KeyRing: openpgp.EntityList{signer}}
+
+	prov, err := signatory.ClearSign(chartZip)
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(chartZip+".prov", []byte(prov), 0600)
+	assert.NoError(t, err)
+
+	var pubring bytes.Buffer
+	assert.NoError(t, signer.Serialize(&pubring))
+
+	keyring := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "keyring",
+			Namespace: "default",
+		},
+		Data: map[string][]byte{
+			KeyringSecretKey: pubring.Bytes(),
+		},
+	}
+
+	hr := &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "subscription-release-test-1-cr",
+			Namespace: "default",
+		},
+		Repo: appv1.HelmReleaseRepo{
+			Source: &appv1.Source{
+				SourceType: appv1.HelmRepoSourceType,
+				HelmRepo: &appv1.HelmRepo{
+					Urls: []string{"file:" + repoDir},
+				},
+			},
+			ChartName: "subscription-release-test-1",
+			Version:   "0.1.0",
+		},
+	}
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	chartDir, _, _, err := DownloadChart(nil, nil, keyring, dir, hr)
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(chartDir, "Chart.yaml"))
+	assert.NoError(t, err)
+
+	// a keyring without the signer public key fails the verification
+	other, err := openpgp.NewEntity("other", "test", "other@example.com", nil)
+	assert.NoError(t, err)
+
+	pubring.Reset()
+	assert.NoError(t, other.Serialize(&pubring))
+
+	keyring.Data[KeyringSecretKey] = pubring.Bytes()
+
+	_, _, _, err = DownloadChart(nil, nil, keyring, dir, hr)
+	assert.True(t, errors.Is(err, ErrProvenanceVerification))
+
+	// a missing provenance file fails the verification
+	assert.NoError(t, os.Remove(chartZip+".prov"))
+
+	_, _, _, err = DownloadChart(nil, nil, keyring, dir, hr)
+	assert.True(t, errors.Is(err, ErrProvenanceVerification))
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+)
+
+var (
+	chartDownloadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "helmrelease_chart_download_duration_seconds",
+		Help:    "Duration of the chart downloads, including the chart cache hits, by source type and url host",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"source_type", "host"})
+	chartDownloadFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "helmrelease_chart_download_failures_total",
+		Help: "Number of failed chart downloads by source type and url host",
+	}, []string{"source_type", "host"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(chartDownloadDuration, chartDownloadFailures)
+}
+
+//observeChartDownload records the duration or the failure of a chart download from the source
+func observeChartDownload(source *appv1.Source, started time.Time, err error) {
+	sourceType := strings.ToLower(string(source.SourceType))
+	host := sourceHost(source)
+
+	if err != nil {
+		chartDownloadFailures.WithLabelValues(sourceType, host).Inc()
+		return
+	}
+
+	chartDownloadDuration.WithLabelValues(sourceType, host).Observe(time.Since(started).Seconds())
+}
+
+//sourceHost returns the host of the first url of the source, empty for the file urls and the invalid ones
+func sourceHost(source *appv1.Source) string {
+	var urls []string
+
+	switch strings.ToLower(string(source.SourceType)) {
+	case string(appv1.HelmRepoSourceType):
+		if source.HelmRepo != nil {
+			urls = source.HelmRepo.Urls
+		}
+	case string(appv1.GitHubSourceType):
+		if source.GitHub != nil {
+			urls = source.GitHub.Urls
+		}
+	case string(appv1.GitSourceType):
+		if source.Git != nil {
+			urls = source.Git.Urls
+		}
+	case string(appv1.OCISourceType):
+		if source.OCI != nil {
+			urls = source.OCI.Urls
+		}
+	}
+
+	if len(urls) == 0 {
+		return ""
+	}
+
+	u := strings.TrimSpace(urls[0])
+
+	// the oci references start with the registry host, with or without the oci scheme
+	if strings.EqualFold(string(source.SourceType), string(appv1.OCISourceType)) {
+		return strings.SplitN(strings.TrimPrefix(u, "oci://"), "/", 2)[0]
+	}
+
+	endpoint, err := transport.NewEndpoint(u)
+	if err != nil {
+		return ""
+	}
+
+	return endpoint.Host
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+)
+
+func TestSourceHost(t *testing.T) {
+	tests := []struct {
+		name   string
+		source *appv1.Source
+		host   string
+	}{
+		{
+			name: "helmrepo",
+			source: &appv1.Source{SourceType: appv1.HelmRepoSourceType, HelmRepo: &appv1.HelmRepo{
+				Urls: []string{"https://charts.example.com:8443/stable", "https://mirror.example.com"}}},
+			host: "charts.example.com",
+		},
+		{
+			name: "helmrepo file",
+			source: &appv1.Source{SourceType: appv1.HelmRepoSourceType, HelmRepo: &appv1.HelmRepo{
+				Urls: []string{"file:///charts/nginx-1.0.0.tgz"}}},
+			host: "",
+		},
+		{
+			name: "git ssh",
+			source: &appv1.Source{SourceType: appv1.GitSourceType, Git: &appv1.Git{
+				Urls: []string{"git@github.com:open-cluster-management/charts.git"}}},
+			host: "github.com",
+		},
+		{
+			name: "oci without scheme",
+			source: &appv1.Source{SourceType: appv1.OCISourceType, OCI: &appv1.OCI{
+				Urls: []string{"quay.io/charts/nginx:1.0.0"}}},
+			host: "quay.io",
+		},
+		{
+			name:   "no urls",
+			source: &appv1.Source{SourceType: appv1.GitHubSourceType},
+			host:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.host, sourceHost(tt.source))
+		})
+	}
+}
+
+func TestObserveChartDownload(t *testing.T) {
+	source := &appv1.Source{SourceType: appv1.OCISourceType, OCI: &appv1.OCI{
+		Urls: []string{"oci://registry.example.com/charts/nginx"}}}
+
+	failures := chartDownloadFailures.WithLabelValues("oci", "registry.example.com")
+	before := testutil.ToFloat64(failures)
+
+	observeChartDownload(source, time.Now(), errors.New("unauthorized"))
+	assert.Equal(t, before+1, testutil.ToFloat64(failures))
+
+	observeChartDownload(source, time.Now(), nil)
+	assert.Equal(t, before+1, testutil.ToFloat64(failures))
+}
@@ -0,0 +1,440 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+)
+
+const (
+	//OCIManifestMediaType is the media type of the OCI image manifest
+	OCIManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	//HelmChartContentLayerMediaType is the media type of the helm chart layer in an OCI manifest
+	HelmChartContentLayerMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	//legacyChartLayerMediaType is the chart layer media type pushed by helm versions prior to 3.7
+	legacyChartLayerMediaType = "application/tar+gzip"
+)
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+//ociReference is a parsed oci://host/repository reference
+type ociReference struct {
+	Host       string
+	Repository string
+	Tag        string
+}
+
+//DownloadChartFromOCI downloads a chart from an OCI registry into the chart cache and expands it into the chartDir,
+//the chart tag is the Repo.Version
+func DownloadChartFromOCI(configMap *corev1.ConfigMap,
+	secret *corev1.Secret,
+	cache *ChartCache,
+	s *appv1.HelmRelease) (chartDir string, err error) {
+	chartDir, _, err = downloadChartFromOCI(configMap, secret, cache, s)
+
+	return chartDir, err
+}
+
+//downloadChartFromOCI downloads a chart from an OCI registry into the chart cache, expands it into the chartDir
+//and returns the url it was pulled from
+func downloadChartFromOCI(configMap *corev1.ConfigMap,
+	secret *corev1.Secret,
+	cache *ChartCache,
+	s *appv1.HelmRelease) (chartDir string, ociURL string, err error) {
+	if s.Repo.Source.OCI == nil {
+		err := fmt.Errorf("oci type but Repo.Source.OCI is not defined")
+		return "", "", err
+	}
+
+	var urlsError string
+
+	digestMismatch := false
+
+	for _, ociURL := range s.Repo.Source.OCI.Urls {
+		chartDir, err = downloadChartFromOCIURL(configMap, secret, cache, s, ociURL)
+		if err == nil {
+			return chartDir, ociURL, nil
+		}
+
+		urlsError += " - url: " + ociURL + " error: " + err.Error()
+
+		if errors.Is(err, ErrDigestMismatch) {
+			digestMismatch = true
+		}
+	}
+
+	if digestMismatch {
+		return "", "", fmt.Errorf("%w, failed to download chart from oci registry. %s", ErrDigestMismatch, urlsError)
+	}
+
+	return "", "", fmt.Errorf("failed to download chart from oci registry. %s", urlsError)
+}
+
+//parseOCIReference parses an oci://host/repository[:tag] url, the version overrides the url tag when set
+func parseOCIReference(ociURL, version string) (*ociReference, error) {
+	u, err := url.Parse(ociURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "oci" {
+		return nil, fmt.Errorf("url %s is not an oci url", ociURL)
+	}
+
+	repository := strings.Trim(u.Path, "/")
+	if u.Host == "" || repository == "" {
+		return nil, fmt.Errorf("url %s must be in the form oci://registry/repository", ociURL)
+	}
+
+	tag := ""
+
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		tag = repository[i+1:]
+		repository = repository[:i]
+	}
+
+	if version != "" {
+		tag = version
+	}
+
+	if tag == "" {
+		return nil, fmt.Errorf("no tag specified for %s, set the version", ociURL)
+	}
+
+	//OCI tags do not allow '+', helm replaces it with '_' when pushing
+	tag = strings.ReplaceAll(tag, "+", "_")
+
+	return &ociReference{Host: u.Host, Repository: repository, Tag: tag}, nil
+}
+
+func downloadChartFromOCIURL(configMap *corev1.ConfigMap,
+	secret *corev1.Secret,
+	cache *ChartCache,
+	s *appv1.HelmRelease,
+	ociURL string) (chartDir string, err error) {
+	ref, err := parseOCIReference(ociURL, s.Repo.Version)
+	if err != nil {
+		klog.Error(err, " - url: ", ociURL)
+		return "", err
+	}
+
+	httpClient, err := GetHelmRepoClient(s.Namespace, configMap, s.Repo.InsecureSkipVerify)
+	if err != nil {
+		klog.Error(err, " - Failed to create httpClient")
+		return "", err
+	}
+
+	registry := &ociRegistryClient{httpClient: httpClient, ref: ref}
+	registry.user, registry.password, err = GetRegistryCredentials(secret, ref.Host)
+
+	if err != nil {
+		klog.Error(err, " - Failed to read the registry credentials for ", ref.Host)
+		return "", err
+	}
+
+	layer, err := registry.chartLayer()
+	if err != nil {
+		klog.Error(err, " - url: ", ociURL)
+		return "", err
+	}
+
+	if s.Repo.Digest != "" && strings.TrimPrefix(s.Repo.Digest, "sha256:") != strings.TrimPrefix(layer.Digest, "sha256:") {
+		err = fmt.Errorf("%w, expected %s got %s", ErrDigestMismatch, s.Repo.Digest, layer.Digest)
+		klog.Error(err, " - url: ", ociURL)
+
+		return "", err
+	}
+
+	chartName := s.Repo.ChartName
+	if chartName == "" {
+		chartName = path.Base(ref.Repository)
+	}
+
+	//The layer digest is part of the key so a moved tag triggers a new download
+	key := ChartCacheKey(ociURL, ref.Tag, layer.Digest, secret)
+
+	chartZip, err := cache.Fetch(key, layer.Digest, func(entryDir string) (string, error) {
+		chartZip := filepath.Join(entryDir, path.Base(ref.Repository)+"-"+ref.Tag+".tgz")
+		return chartZip, registry.downloadBlob(layer.Digest, chartZip)
+	})
+	if err != nil {
+		klog.Error(err, " - url: ", ociURL)
+		return "", err
+	}
+
+	return cache.Expand(key, chartZip, chartName)
+}
+
+//GetRegistryCredentials returns the user and password for the registry host from the secret,
+//the secret can hold user/password keys or be a dockerconfigjson secret
+func GetRegistryCredentials(secret *corev1.Secret, host string) (user, password string, err error) {
+	if secret == nil || secret.Data == nil {
+		return "", "", nil
+	}
+
+	dockerConfig, ok := secret.Data[corev1.DockerConfigJsonKey]
+	if !ok {
+		return string(secret.Data["user"]), GetPassword(secret), nil
+	}
+
+	config := struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Auth     string `json:"auth"`
+		} `json:"auths"`
+	}{}
+
+	err = json.Unmarshal(dockerConfig, &config)
+	if err != nil {
+		return "", "", err
+	}
+
+	for registry, auth := range config.Auths {
+		//Entries can be stored as a plain host or as an url
+		registryHost := strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+		if registryHost != host && !strings.HasPrefix(registryHost, host+"/") {
+			continue
+		}
+
+		if auth.Username != "" {
+			return auth.Username, auth.Password, nil
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return "", "", err
+		}
+
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return "", "", fmt.Errorf("invalid auth entry for registry %s", registry)
+		}
+
+		return parts[0], parts[1], nil
+	}
+
+	klog.V(5).Info("No credentials found in dockerconfigjson for registry ", host)
+
+	return "", "", nil
+}
+
+type ociRegistryClient struct {
+	httpClient rest.HTTPClient
+	ref        *ociReference
+	user       string
+	password   string
+	token      string
+}
+
+//chartLayer retrieves the manifest of the tag and returns its chart layer
+func (c *ociRegistryClient) chartLayer() (*ociDescriptor, error) {
+	resp, err := c.get(fmt.Sprintf("/v2/%s/manifests/%s", c.ref.Repository, c.ref.Tag), OCIManifestMediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	manifest := &ociManifest{}
+
+	err = json.NewDecoder(resp.Body).Decode(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range manifest.Layers {
+		if manifest.Layers[i].MediaType == HelmChartContentLayerMediaType || manifest.Layers[i].MediaType == legacyChartLayerMediaType {
+			return &manifest.Layers[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("no helm chart layer found in %s/%s:%s", c.ref.Host, c.ref.Repository, c.ref.Tag)
+}
+
+func (c *ociRegistryClient) downloadBlob(digest, chartZip string) error {
+	resp, err := c.get(fmt.Sprintf("/v2/%s/blobs/%s", c.ref.Repository, digest), "")
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	out, err := os.Create(chartZip)
+	if err != nil {
+		klog.Error(err, " - Failed to create: ", chartZip)
+		return err
+	}
+
+	defer closeHelper(out)
+
+	_, err = io.Copy(out, resp.Body)
+	if err != nil {
+		klog.Error(err, " - Failed to copy body:", chartZip)
+	}
+
+	return err
+}
+
+//get sends a GET to the registry, answering a bearer token challenge once when needed
+func (c *ociRegistryClient) get(apiPath, accept string) (*http.Response, error) {
+	resp, err := c.do(apiPath, accept)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && c.token == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			return nil, fmt.Errorf("return code: %d unauthorized access to %s", http.StatusUnauthorized, c.ref.Host)
+		}
+
+		c.token, err = c.fetchToken(challenge)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err = c.do(apiPath, accept)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("return code: %d unable to retrieve %s from %s", resp.StatusCode, apiPath, c.ref.Host)
+	}
+
+	return resp, nil
+}
+
+func (c *ociRegistryClient) do(apiPath, accept string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://"+c.ref.Host+apiPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.user != "":
+		req.SetBasicAuth(c.user, c.password)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+//fetchToken requests a bearer token from the realm of the WWW-Authenticate challenge
+func (c *ociRegistryClient) fetchToken(challenge string) (string, error) {
+	params := map[string]string{}
+
+	for _, p := range strings.Split(challenge[len("bearer "):], ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid bearer challenge from %s: %s", c.ref.Host, challenge)
+	}
+
+	q := realm.Query()
+
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", c.ref.Repository)
+	}
+
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("return code: %d unable to retrieve a token from %s", resp.StatusCode, realm.Host)
+	}
+
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return "", err
+	}
+
+	if token.Token != "" {
+		return token.Token, nil
+	}
+
+	if token.AccessToken != "" {
+		return token.AccessToken, nil
+	}
+
+	return "", fmt.Errorf("no token returned by %s", realm.Host)
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+)
+
+const (
+	testRegistryUser     = "helmrelease"
+	testRegistryPassword = "secret"
+	testRegistryToken    = "registry-token"
+)
+
+//newTestRegistry starts a registry stand-in serving the test chart under test/subscription-release-test-1:0.1.0,
+//clients must authenticate with a bearer token obtained with basic auth
+func newTestRegistry(t *testing.T) (*httptest.Server, string) {
+	chart, err := ioutil.ReadFile("../../test/helmrepo/subscription-release-test-1-0.1.0.tgz")
+	assert.NoError(t, err)
+
+	sum := sha256.Sum256(chart)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	manifest, err := json.Marshal(ociManifest{
+		Layers: []ociDescriptor{
+			{MediaType: "application/vnd.cncf.helm.config.v1+json", Digest: "sha256:0"},
+			{MediaType: HelmChartContentLayerMediaType, Digest: digest, Size: int64(len(chart))},
+		},
+	})
+	assert.NoError(t, err)
+
+	var server *httptest.Server
+
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if user, password, ok := r.BasicAuth(); !ok || user != testRegistryUser || password != testRegistryPassword {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			fmt.Fprintf(w, `{"token":"%s"}`, testRegistryToken)
+
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer "+testRegistryToken {
+			w.Header().Set("WWW-Authenticate",
+				fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:test/subscription-release-test-1:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/test/subscription-release-test-1/manifests/0.1.0":
+			w.Header().Set("Content-Type", OCIManifestMediaType)
+			_, _ = w.Write(manifest)
+		case "/v2/test/subscription-release-test-1/blobs/" + digest:
+			_, _ = w.Write(chart)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return server, digest
+}
+
+func newOCIHelmRelease(server *httptest.Server, version string) *appv1.HelmRelease {
+	return &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "subscription-release-test-1-cr",
+			Namespace: "default",
+		},
+		Repo: appv1.HelmReleaseRepo{
+			Source: &appv1.Source{
+				SourceType: appv1.OCISourceType,
+				OCI: &appv1.OCI{
+					Urls: []string{"oci://" + strings.TrimPrefix(server.URL, "https://") + "/test/subscription-release-test-1"},
+				},
+			},
+			ChartName:          "subscription-release-test-1",
+			Version:            version,
+			InsecureSkipVerify: true,
+		},
+	}
+}
+
+func TestDownloadChartFromOCI(t *testing.T) {
+	server, digest := newTestRegistry(t)
+	defer server.Close()
+
+	secret := &corev1.Secret{
+		Data: map[string][]byte{
+			"user":     []byte(testRegistryUser),
+			"password": []byte(testRegistryPassword),
+		},
+	}
+
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	hr := newOCIHelmRelease(server, "0.1.0")
+	chartDir, _, sourceURL, err := DownloadChart(nil, secret, nil, dir, hr)
+	assert.NoError(t, err)
+	assert.Equal(t, hr.Repo.Source.OCI.Urls[0], sourceURL)
+
+	_, err = os.Stat(chartDir + "/Chart.yaml")
+	assert.NoError(t, err)
+
+	hr.Repo.Digest = digest
+	_, _, _, err = DownloadChart(nil, secret, nil, dir, hr)
+	assert.NoError(t, err)
+
+	hr.Repo.Digest = "sha256:0000"
+	_, _, _, err = DownloadChart(nil, secret, nil, dir, hr)
+	assert.True(t, errors.Is(err, ErrDigestMismatch))
+
+	_, _, _, err = DownloadChart(nil, secret, nil, dir, newOCIHelmRelease(server, "9.9.9"))
+	assert.Error(t, err)
+
+	_, _, _, err = DownloadChart(nil, nil, nil, dir, newOCIHelmRelease(server, "0.1.0"))
+	assert.Error(t, err)
+}
+
+func TestDownloadChartFromOCIDockerConfig(t *testing.T) {
+	server, _ := newTestRegistry(t)
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	auth := base64.StdEncoding.EncodeToString([]byte(testRegistryUser + ":" + testRegistryPassword))
+
+	secret := &corev1.Secret{
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(fmt.Sprintf(`{"auths":{"%s":{"auth":"%s"}}}`, host, auth)),
+		},
+	}
+
+	dir, err := ioutil.TempDir("/tmp", "charts")
+	assert.NoError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	chartDir, err := DownloadChartFromOCI(nil, secret, NewChartCache(dir), newOCIHelmRelease(server, "0.1.0"))
+	assert.NoError(t, err)
+
+	_, err = os.Stat(chartDir + "/Chart.yaml")
+	assert.NoError(t, err)
+}
+
+func TestParseOCIReference(t *testing.T) {
+	ref, err := parseOCIReference("oci://registry.io/ns/chart:1.0.0", "")
+	assert.NoError(t, err)
+	assert.Equal(t, &ociReference{Host: "registry.io", Repository: "ns/chart", Tag: "1.0.0"}, ref)
+
+	ref, err = parseOCIReference("oci://localhost:5000/ns/chart", "1.0.0+build")
+	assert.NoError(t, err)
+	assert.Equal(t, &ociReference{Host: "localhost:5000", Repository: "ns/chart", Tag: "1.0.0_build"}, ref)
+
+	_, err = parseOCIReference("oci://registry.io/ns/chart", "")
+	assert.Error(t, err)
+
+	_, err = parseOCIReference("https://registry.io/ns/chart", "1.0.0")
+	assert.Error(t, err)
+}
@@ -0,0 +1,302 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+)
+
+var (
+	commitRegexp = regexp.MustCompile("^[0-9a-fA-F]{4,40}$")
+	digestRegexp = regexp.MustCompile("^(sha256:)?[0-9a-fA-F]{64}$")
+)
+
+//ValidateHelmRelease returns the errors of the repo and the release settings of the HelmRelease
+func ValidateHelmRelease(hr *appv1.HelmRelease) field.ErrorList {
+	repoPath := field.NewPath("repo")
+
+	allErrs := validateSource(hr.Repo.Source, hr.Repo.Version, repoPath.Child("source"))
+
+	if hr.Repo.Digest != "" && !digestRegexp.MatchString(hr.Repo.Digest) {
+		allErrs = append(allErrs, field.Invalid(repoPath.Child("digest"), hr.Repo.Digest, "must be a sha256 digest"))
+	}
+
+	if hr.Repo.Verify != nil && hr.Repo.Verify.KeyringSecretRef == nil {
+		allErrs = append(allErrs, field.Required(repoPath.Child("verify", "keyringSecretRef"), ""))
+	}
+
+	if hr.Remediation != nil && hr.Remediation.Retries < 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("remediation", "retries"), hr.Remediation.Retries,
+			"must not be negative"))
+	}
+
+	if hr.MaxHistory < 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("maxHistory"), hr.MaxHistory, "must not be negative"))
+	}
+
+	if hr.Timeout != nil && hr.Timeout.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("timeout"), hr.Timeout.Duration.String(), "must be positive"))
+	}
+
+	if hr.Test != nil && hr.Test.Timeout != nil && hr.Test.Timeout.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("test", "timeout"), hr.Test.Timeout.Duration.String(),
+			"must be positive"))
+	}
+
+	if hr.DriftDetection != nil && hr.DriftDetection.Interval != nil && hr.DriftDetection.Interval.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("driftDetection", "interval"),
+			hr.DriftDetection.Interval.Duration.String(), "must be positive"))
+	}
+
+	if hr.Retry != nil {
+		retryPath := field.NewPath("retry")
+
+		if hr.Retry.BaseDelay != nil && hr.Retry.BaseDelay.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(retryPath.Child("baseDelay"), hr.Retry.BaseDelay.Duration.String(),
+				"must be positive"))
+		}
+
+		if hr.Retry.MaxDelay != nil && hr.Retry.MaxDelay.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(retryPath.Child("maxDelay"), hr.Retry.MaxDelay.Duration.String(),
+				"must be positive"))
+		}
+	}
+
+	if hr.ResyncInterval != nil && hr.ResyncInterval.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("resyncInterval"), hr.ResyncInterval.Duration.String(),
+			"must not be negative"))
+	}
+
+	switch hr.CRDPolicy {
+	case "", appv1.CRDPolicyCreate, appv1.CRDPolicyCreateReplace, appv1.CRDPolicySkip, appv1.CRDPolicyKeepOnUninstall:
+	default:
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("crdPolicy"), hr.CRDPolicy, []string{
+			string(appv1.CRDPolicyCreate), string(appv1.CRDPolicyCreateReplace), string(appv1.CRDPolicySkip),
+			string(appv1.CRDPolicyKeepOnUninstall)}))
+	}
+
+	for i, ref := range hr.ValuesFrom {
+		refPath := field.NewPath("valuesFrom").Index(i)
+
+		if ref.Kind != appv1.ConfigMapValuesKind && ref.Kind != appv1.SecretValuesKind {
+			allErrs = append(allErrs, field.NotSupported(refPath.Child("kind"), ref.Kind,
+				[]string{string(appv1.ConfigMapValuesKind), string(appv1.SecretValuesKind)}))
+		}
+
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(refPath.Child("name"), ""))
+		}
+	}
+
+	for key := range hr.OverrideValues {
+		if strings.TrimSpace(key) == "" {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("overrideValues"), key, "keys must not be empty"))
+		}
+	}
+
+	return allErrs
+}
+
+func validateSource(s *appv1.Source, version string, path *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if s == nil {
+		return append(allErrs, field.Required(path, ""))
+	}
+
+	allErrs = append(allErrs, validateSourceBlocks(s, path)...)
+
+	switch strings.ToLower(string(s.SourceType)) {
+	case string(appv1.HelmRepoSourceType):
+		if s.HelmRepo == nil {
+			return append(allErrs, field.Required(path.Child("helmRepo"), "required for the helmrepo type"))
+		}
+
+		urlsPath := path.Child("helmRepo", "urls")
+		allErrs = append(allErrs, validateUrls(s.HelmRepo.Urls, urlsPath, validateHelmRepoURL)...)
+
+		for _, u := range s.HelmRepo.Urls {
+			if !IsChartArchiveURL(u) {
+				allErrs = append(allErrs, validateChartVersion(version, field.NewPath("repo", "version"))...)
+				break
+			}
+		}
+	case string(appv1.GitHubSourceType):
+		if s.GitHub == nil {
+			return append(allErrs, field.Required(path.Child("github"), "required for the github type"))
+		}
+
+		allErrs = append(allErrs, validateGit(s.GitHub.Urls, s.GitHub.Commit, s.GitHub.PollInterval, path.Child("github"))...)
+	case string(appv1.GitSourceType):
+		if s.Git == nil {
+			return append(allErrs, field.Required(path.Child("git"), "required for the git type"))
+		}
+
+		allErrs = append(allErrs, validateGit(s.Git.Urls, s.Git.Commit, s.Git.PollInterval, path.Child("git"))...)
+	case string(appv1.OCISourceType):
+		if s.OCI == nil {
+			return append(allErrs, field.Required(path.Child("oci"), "required for the oci type"))
+		}
+
+		allErrs = append(allErrs, validateUrls(s.OCI.Urls, path.Child("oci", "urls"), func(u string) string {
+			if _, err := parseOCIReference(u, version); err != nil {
+				return err.Error()
+			}
+
+			return ""
+		})...)
+	default:
+		allErrs = append(allErrs, field.NotSupported(path.Child("type"), s.SourceType, []string{
+			string(appv1.HelmRepoSourceType), string(appv1.GitHubSourceType),
+			string(appv1.GitSourceType), string(appv1.OCISourceType)}))
+	}
+
+	return allErrs
+}
+
+//validateSourceBlocks forbids the source blocks not matching the supported source type, they would be ignored
+func validateSourceBlocks(s *appv1.Source, path *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	switch strings.ToLower(string(s.SourceType)) {
+	case string(appv1.HelmRepoSourceType), string(appv1.GitHubSourceType),
+		string(appv1.GitSourceType), string(appv1.OCISourceType):
+	default:
+		return allErrs
+	}
+
+	blocks := []struct {
+		name       string
+		set        bool
+		sourceType appv1.SourceTypeEnum
+	}{
+		{name: "helmRepo", set: s.HelmRepo != nil, sourceType: appv1.HelmRepoSourceType},
+		{name: "github", set: s.GitHub != nil, sourceType: appv1.GitHubSourceType},
+		{name: "git", set: s.Git != nil, sourceType: appv1.GitSourceType},
+		{name: "oci", set: s.OCI != nil, sourceType: appv1.OCISourceType},
+	}
+
+	for _, block := range blocks {
+		if block.set && !strings.EqualFold(string(s.SourceType), string(block.sourceType)) {
+			allErrs = append(allErrs, field.Forbidden(path.Child(block.name),
+				"must not be set for the "+string(s.SourceType)+" type"))
+		}
+	}
+
+	return allErrs
+}
+
+func validateGit(urls []string, commit string, pollInterval *metav1.Duration, path *field.Path) field.ErrorList {
+	allErrs := validateUrls(urls, path.Child("urls"), validateGitURL)
+
+	if commit != "" && !commitRegexp.MatchString(commit) {
+		allErrs = append(allErrs, field.Invalid(path.Child("commit"), commit, "must be a commit SHA"))
+	}
+
+	if pollInterval != nil && pollInterval.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("pollInterval"), pollInterval.Duration.String(), "must be positive"))
+	}
+
+	return allErrs
+}
+
+//validateUrls checks that the urls are set and validates each of them, validate returns the error message
+func validateUrls(urls []string, path *field.Path, validate func(string) string) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if len(urls) == 0 {
+		return append(allErrs, field.Required(path, ""))
+	}
+
+	for i, u := range urls {
+		if msg := validate(strings.TrimSpace(u)); msg != "" {
+			allErrs = append(allErrs, field.Invalid(path.Index(i), u, msg))
+		}
+	}
+
+	return allErrs
+}
+
+func validateHelmRepoURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err.Error()
+	}
+
+	switch parsed.Scheme {
+	case "http", "https":
+		if parsed.Host == "" {
+			return "must have a host"
+		}
+	case "file":
+	default:
+		return "must be an http, https or file url"
+	}
+
+	return ""
+}
+
+func validateGitURL(u string) string {
+	if u == "" {
+		return "must not be empty"
+	}
+
+	endpoint, err := transport.NewEndpoint(u)
+	if err != nil {
+		return err.Error()
+	}
+
+	switch endpoint.Protocol {
+	case "http", "https", "ssh", "git":
+		if endpoint.Host == "" {
+			return "must have a host"
+		}
+	case "file":
+	default:
+		return "must be an http, https, ssh, git or file url"
+	}
+
+	return ""
+}
+
+//validateChartVersion checks that the version of a chart resolved from a helm repo index is a version or a semver range
+func validateChartVersion(version string, path *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if version == "" {
+		return allErrs
+	}
+
+	if _, err := semver.NewVersion(version); err == nil {
+		return allErrs
+	}
+
+	if _, err := semver.NewConstraint(version); err != nil {
+		allErrs = append(allErrs, field.Invalid(path, version, "must be a chart version or a semver range"))
+	}
+
+	return allErrs
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+)
+
+func TestValidateHelmRelease(t *testing.T) {
+	tests := []struct {
+		name   string
+		repo   appv1.HelmReleaseRepo
+		fields []string
+	}{
+		{
+			name: "valid helm repo",
+			repo: appv1.HelmReleaseRepo{
+				Source: &appv1.Source{
+					SourceType: appv1.HelmRepoSourceType,
+					HelmRepo:   &appv1.HelmRepo{Urls: []string{"https://charts.helm.sh/stable"}},
+				},
+				ChartName: "nginx-ingress",
+				Version:   "~1.26",
+			},
+		},
+		{
+			name: "chart archive with any version",
+			repo: appv1.HelmReleaseRepo{
+				Source: &appv1.Source{
+					SourceType: appv1.HelmRepoSourceType,
+					HelmRepo:   &appv1.HelmRepo{Urls: []string{"https://charts.example.com/chart-3-0.1.0.tgz"}},
+				},
+				Version: "3-0.1.0",
+			},
+		},
+		{
+			name:   "missing source",
+			repo:   appv1.HelmReleaseRepo{},
+			fields: []string{"repo.source"},
+		},
+		{
+			name: "git type without git",
+			repo: appv1.HelmReleaseRepo{
+				Source: &appv1.Source{
+					SourceType: appv1.GitSourceType,
+					GitHub:     &appv1.GitHub{Urls: []string{"https://github.com/example/charts.git"}},
+				},
+			},
+			fields: []string{"repo.source.git", "repo.source.github"},
+		},
+		{
+			name: "helmrepo type with git and oci",
+			repo: appv1.HelmReleaseRepo{
+				Source: &appv1.Source{
+					SourceType: appv1.HelmRepoSourceType,
+					HelmRepo:   &appv1.HelmRepo{Urls: []string{"https://charts.helm.sh/stable"}},
+					Git:        &appv1.Git{Urls: []string{"https://github.com/example/charts.git"}},
+					OCI:        &appv1.OCI{Urls: []string{"oci://registry.example.com/charts/nginx:1.0.0"}},
+				},
+				ChartName: "nginx-ingress",
+				Version:   "~1.26",
+			},
+			fields: []string{"repo.source.git", "repo.source.oci"},
+		},
+		{
+			name: "unsupported type",
+			repo: appv1.HelmReleaseRepo{
+				Source: &appv1.Source{SourceType: "svn"},
+			},
+			fields: []string{"repo.source.type"},
+		},
+		{
+			name: "bad urls and version",
+			repo: appv1.HelmReleaseRepo{
+				Source: &appv1.Source{
+					SourceType: appv1.HelmRepoSourceType,
+					HelmRepo:   &appv1.HelmRepo{Urls: []string{"ftp://charts.example.com", "https://charts.example.com"}},
+				},
+				Version: "not a version",
+				Digest:  "1234",
+			},
+			fields: []string{"repo.source.helmRepo.urls[0]", "repo.version", "repo.digest"},
+		},
+		{
+			name: "git commit and poll interval",
+			repo: appv1.HelmReleaseRepo{
+				Source: &appv1.Source{
+					SourceType: appv1.GitHubSourceType,
+					GitHub: &appv1.GitHub{
+						Urls:         []string{"git@github.com:example/charts.git"},
+						Commit:       "main",
+						PollInterval: &metav1.Duration{},
+					},
+				},
+			},
+			fields: []string{"repo.source.github.commit", "repo.source.github.pollInterval"},
+		},
+		{
+			name: "oci without tag",
+			repo: appv1.HelmReleaseRepo{
+				Source: &appv1.Source{
+					SourceType: appv1.OCISourceType,
+					OCI:        &appv1.OCI{Urls: []string{"oci://registry.example.com/charts/nginx"}},
+				},
+			},
+			fields: []string{"repo.source.oci.urls[0]"},
+		},
+		{
+			name: "verify without keyring",
+			repo: appv1.HelmReleaseRepo{
+				Source: &appv1.Source{
+					SourceType: appv1.OCISourceType,
+					OCI:        &appv1.OCI{Urls: []string{"oci://registry.example.com/charts/nginx"}},
+				},
+				Version: "1.0.0",
+				Verify:  &appv1.ChartVerification{},
+			},
+			fields: []string{"repo.verify.keyringSecretRef"},
+		},
+	}
+
+	for _, tt := range tests {
+		errs := ValidateHelmRelease(&appv1.HelmRelease{Repo: tt.repo})
+
+		fields := []string{}
+		for _, err := range errs {
+			fields = append(fields, err.Field)
+		}
+
+		assert.ElementsMatch(t, tt.fields, fields, tt.name)
+	}
+
+	errs := ValidateHelmRelease(&appv1.HelmRelease{
+		Repo: tests[0].repo,
+		ValuesFrom: []appv1.ValuesReference{
+			{Kind: appv1.ConfigMapValuesKind, Name: "values"},
+			{Kind: "Pod"},
+		},
+	})
+	assert.Len(t, errs, 2)
+	assert.Equal(t, "valuesFrom[1].kind", errs[0].Field)
+	assert.Equal(t, "valuesFrom[1].name", errs[1].Field)
+
+	errs = ValidateHelmRelease(&appv1.HelmRelease{
+		Repo:        tests[0].repo,
+		Remediation: &appv1.Remediation{Retries: -1},
+		MaxHistory:  -1,
+		Timeout:     &metav1.Duration{},
+		Test:        &appv1.ReleaseTest{Timeout: &metav1.Duration{}},
+		DriftDetection: &appv1.DriftDetection{
+			Interval: &metav1.Duration{},
+		},
+		Retry: &appv1.Retry{
+			BaseDelay: &metav1.Duration{},
+			MaxDelay:  &metav1.Duration{Duration: -time.Minute},
+		},
+		ResyncInterval: &metav1.Duration{Duration: -time.Minute},
+		CRDPolicy:      "Replace",
+	})
+	assert.Len(t, errs, 9)
+	assert.Equal(t, "remediation.retries", errs[0].Field)
+	assert.Equal(t, "maxHistory", errs[1].Field)
+	assert.Equal(t, "timeout", errs[2].Field)
+	assert.Equal(t, "test.timeout", errs[3].Field)
+	assert.Equal(t, "driftDetection.interval", errs[4].Field)
+	assert.Equal(t, "retry.baseDelay", errs[5].Field)
+	assert.Equal(t, "retry.maxDelay", errs[6].Field)
+	assert.Equal(t, "resyncInterval", errs[7].Field)
+	assert.Equal(t, "crdPolicy", errs[8].Field)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	rspb "helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/api/admission/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+	helmoperator "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/release"
+	"github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/utils"
+)
+
+const (
+	// MutateHelmReleasePath is the path of the HelmRelease defaulting webhook
+	MutateHelmReleasePath = "/mutate-apps-open-cluster-management-io-v1-helmrelease"
+	// ValidateHelmReleasePath is the path of the HelmRelease validating webhook
+	ValidateHelmReleasePath = "/validate-apps-open-cluster-management-io-v1-helmrelease"
+)
+
+// helmReleaseValidator rejects the invalid HelmReleases and the HelmReleases colliding with an existing helm release
+type helmReleaseValidator struct {
+	// releaseHistory returns the helm release history of the release name in the namespace with the labels of
+	// the storage secrets
+	releaseHistory func(namespace, name string) ([]*rspb.Release, error)
+	decoder        *admission.Decoder
+}
+
+// blank assignment to verify that helmReleaseValidator implements admission.DecoderInjector
+var _ admission.DecoderInjector = &helmReleaseValidator{}
+
+func addHelmReleaseDefaulter(mgr manager.Manager) error {
+	klog.Info("Registering the HelmRelease defaulting webhook at ", MutateHelmReleasePath)
+
+	mgr.GetWebhookServer().Register(MutateHelmReleasePath, admission.DefaultingWebhookFor(&appv1.HelmRelease{}))
+
+	return nil
+}
+
+func addHelmReleaseValidator(mgr manager.Manager) error {
+	clientv1, err := v1.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return fmt.Errorf("failed to get core/v1 client: %w", err)
+	}
+
+	klog.Info("Registering the HelmRelease validating webhook at ", ValidateHelmReleasePath)
+
+	mgr.GetWebhookServer().Register(ValidateHelmReleasePath, &webhook.Admission{
+		Handler: &helmReleaseValidator{
+			releaseHistory: func(namespace, name string) ([]*rspb.Release, error) {
+				// unlike the history of the storage, the list keeps the labels of the storage secrets
+				return driver.NewSecrets(clientv1.Secrets(namespace)).List(func(rls *rspb.Release) bool {
+					return rls.Name == name
+				})
+			},
+		},
+	})
+
+	return nil
+}
+
+// InjectDecoder injects the decoder of the webhook server
+func (v *helmReleaseValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle validates the created and updated HelmReleases
+func (v *helmReleaseValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != v1beta1.Create && req.Operation != v1beta1.Update {
+		return admission.Allowed("")
+	}
+
+	hr := &appv1.HelmRelease{}
+
+	if err := v.decoder.Decode(req, hr); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// the HelmReleases being deleted must be allowed to remove their finalizer
+	if hr.GetDeletionTimestamp() != nil {
+		return admission.Allowed("")
+	}
+
+	allErrs := utils.ValidateHelmRelease(hr)
+
+	if req.Operation == v1beta1.Create {
+		allErrs = append(allErrs, v.validateReleaseName(hr)...)
+	}
+
+	if len(allErrs) > 0 {
+		klog.Info("Rejecting HelmRelease ", hr.GetNamespace(), "/", hr.GetName(), ": ", allErrs.ToAggregate())
+
+		return admission.Denied(apierrors.NewInvalid(appv1.SchemeGroupVersion.WithKind("HelmRelease").GroupKind(),
+			hr.GetName(), allErrs).Error())
+	}
+
+	return admission.Allowed("")
+}
+
+// validateReleaseName rejects a new HelmRelease when a helm release not deployed by a HelmRelease already has its
+// name. The release of a deleted HelmRelease of the same name is adopted, the storage secrets of the releases
+// deployed by the HelmReleases are labeled with their UID.
+func (v *helmReleaseValidator) validateReleaseName(hr *appv1.HelmRelease) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	history, err := v.releaseHistory(hr.GetNamespace(), hr.GetName())
+	if err != nil {
+		// the controller reports the collision if the release history can not be read
+		klog.Error(err, " - Failed to get the helm release history of ", hr.GetNamespace(), "/", hr.GetName())
+		return allErrs
+	}
+
+	if len(history) == 0 {
+		return allErrs
+	}
+
+	latest := history[0]
+	for _, rls := range history {
+		if rls.Version > latest.Version {
+			latest = rls
+		}
+	}
+
+	if latest.Labels[helmoperator.HelmReleaseUIDLabel] != "" {
+		return allErrs
+	}
+
+	chartName := ""
+	if latest.Chart != nil {
+		chartName = latest.Chart.Name()
+	}
+
+	return append(allErrs, field.Invalid(field.NewPath("metadata", "name"), hr.GetName(),
+		fmt.Sprintf("a helm release of the chart %s not deployed by a HelmRelease already exists with this name",
+			chartName)))
+}
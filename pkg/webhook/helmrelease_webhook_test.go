@@ -0,0 +1,152 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	rspb "helm.sh/helm/v3/pkg/release"
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	appv1 "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/apis/apps/v1"
+	helmoperator "github.com/open-cluster-management/multicloud-operators-subscription-release/pkg/release"
+)
+
+// newTestValidator returns a validator of the releases, the release labels by namespace/name
+func newTestValidator(t *testing.T, releases map[string]map[string]string) *helmReleaseValidator {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, appv1.SchemeBuilder.AddToScheme(scheme))
+
+	decoder, err := admission.NewDecoder(scheme)
+	assert.NoError(t, err)
+
+	v := &helmReleaseValidator{
+		releaseHistory: func(namespace, name string) ([]*rspb.Release, error) {
+			labels, ok := releases[namespace+"/"+name]
+			if !ok {
+				return nil, nil
+			}
+
+			return []*rspb.Release{{
+				Name:    name,
+				Version: 1,
+				Chart:   &chart.Chart{Metadata: &chart.Metadata{Name: "nginx-ingress"}},
+				Labels:  labels,
+			}}, nil
+		},
+	}
+	assert.NoError(t, v.InjectDecoder(decoder))
+
+	return v
+}
+
+func newTestRequest(t *testing.T, operation v1beta1.Operation, hr *appv1.HelmRelease) admission.Request {
+	hr.APIVersion = appv1.SchemeGroupVersion.String()
+	hr.Kind = "HelmRelease"
+
+	raw, err := json.Marshal(hr)
+	assert.NoError(t, err)
+
+	return admission.Request{AdmissionRequest: v1beta1.AdmissionRequest{
+		Operation: operation,
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+}
+
+func newTestHelmRelease(name string) *appv1.HelmRelease {
+	return &appv1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Repo: appv1.HelmReleaseRepo{
+			Source: &appv1.Source{
+				SourceType: appv1.HelmRepoSourceType,
+				HelmRepo:   &appv1.HelmRepo{Urls: []string{"https://charts.helm.sh/stable"}},
+			},
+			ChartName: "nginx-ingress",
+			Version:   "1.26.0",
+		},
+	}
+}
+
+func TestHelmReleaseValidator(t *testing.T) {
+	v := newTestValidator(t, map[string]map[string]string{
+		"default/nginx":     {"owner": "helm", helmoperator.HelmReleaseUIDLabel: "0c1d6ed6-ab36-4bd6-8a2b-2f0ef8c3c1a8"},
+		"default/collision": {"owner": "helm"},
+	})
+
+	resp := v.Handle(context.TODO(), newTestRequest(t, v1beta1.Create, newTestHelmRelease("new")))
+	assert.True(t, resp.Allowed)
+
+	// the release deployed for a deleted HelmRelease of the same name is adopted
+	resp = v.Handle(context.TODO(), newTestRequest(t, v1beta1.Create, newTestHelmRelease("nginx")))
+	assert.True(t, resp.Allowed)
+
+	// the release of the same chart not deployed by a HelmRelease is not taken over
+	resp = v.Handle(context.TODO(), newTestRequest(t, v1beta1.Create, newTestHelmRelease("collision")))
+	assert.False(t, resp.Allowed)
+	assert.Contains(t, resp.Result.Reason, "not deployed by a HelmRelease")
+
+	// the collision is only checked on create
+	resp = v.Handle(context.TODO(), newTestRequest(t, v1beta1.Update, newTestHelmRelease("collision")))
+	assert.True(t, resp.Allowed)
+
+	hr := newTestHelmRelease("new")
+	hr.Repo.Source.SourceType = appv1.GitSourceType
+
+	resp = v.Handle(context.TODO(), newTestRequest(t, v1beta1.Update, hr))
+	assert.False(t, resp.Allowed)
+	assert.Contains(t, resp.Result.Reason, "repo.source.git")
+
+	now := metav1.Now()
+	hr.DeletionTimestamp = &now
+
+	resp = v.Handle(context.TODO(), newTestRequest(t, v1beta1.Update, hr))
+	assert.True(t, resp.Allowed)
+}
+
+func TestHelmReleaseDefaulter(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, appv1.SchemeBuilder.AddToScheme(scheme))
+
+	defaulter := admission.DefaultingWebhookFor(&appv1.HelmRelease{})
+	assert.NoError(t, defaulter.InjectScheme(scheme))
+
+	hr := newTestHelmRelease("defaults")
+	hr.Repo.Source = &appv1.Source{
+		GitHub: &appv1.GitHub{Urls: []string{"https://github.com/example/charts.git"}},
+	}
+	hr.ValuesFrom = []appv1.ValuesReference{{Kind: appv1.ConfigMapValuesKind, Name: "values"}}
+
+	resp := defaulter.Handle(context.TODO(), newTestRequest(t, v1beta1.Create, hr))
+	assert.True(t, resp.Allowed)
+
+	patches := map[string]interface{}{}
+	for _, patch := range resp.Patches {
+		patches[patch.Path] = patch.Value
+	}
+
+	assert.Equal(t, map[string]interface{}{}, patches["/spec"])
+	assert.Equal(t, "github", patches["/repo/source/type"])
+	assert.Equal(t, appv1.DefaultGitBranch, patches["/repo/source/github/branch"])
+	assert.Equal(t, appv1.DefaultValuesKey, patches["/valuesFrom/0/valuesKey"])
+}